@@ -0,0 +1,222 @@
+// DB.Batch, batch, call and errTrySolo are adapted from bbolt
+// (https://github.com/etcd-io/bbolt), distributed under the following terms:
+//
+// The MIT License (MIT)
+//
+// Copyright (c) 2013 Ben Johnson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package gmdbx
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errTrySolo is sent to a batched call whose fn failed, so it is run again in
+// its own transaction.
+var errTrySolo = errors.New("batch function returned an error and should be re-run solo")
+
+// BatchStats metrics of DB.Batch
+type BatchStats struct {
+	Batches   uint64 // write transactions committed for batches
+	Calls     uint64 // calls to Batch
+	SoloCalls uint64 // failed calls re-run in their own transaction
+	MaxSize   uint64 // largest number of calls committed together
+	LastSize  uint64 // number of calls in the last batch
+}
+
+type call struct {
+	fn  func(*Tx) error
+	err chan<- error
+}
+
+type batch struct {
+	db    *DB
+	timer *time.Timer
+	start sync.Once
+	calls []call
+}
+
+// Batch calls fn as part of a batch. It behaves similar to Update,
+// except:
+//
+// 1. concurrent Batch calls can be combined into a single write
+// transaction, so they pay for one commit and sync.
+//
+// 2. the function passed to Batch may be called multiple times,
+// regardless of whether it returns error or not.
+//
+// This means that Batch function side effects must be idempotent and
+// take permanent effect only after a successful return is seen in
+// caller.
+//
+// If one fn fails the batch is rolled back and retried without it, the
+// failed fn is then run alone so its error does not poison the others.
+//
+// The maximum batch size and delay can be adjusted with MaxBatchSize and
+// MaxBatchDelay of Option.
+//
+// Batch is only useful when there are multiple goroutines calling it.
+func (d *DB) Batch(fn func(*Tx) error) error {
+	if d.opts.MaxBatchSize <= 0 || d.opts.MaxBatchDelay <= 0 {
+		return d.update(fn)
+	}
+
+	errCh := make(chan error, 1)
+
+	d.batchMu.Lock()
+	if (d.batch == nil) || (d.batch != nil && len(d.batch.calls) >= d.opts.MaxBatchSize) {
+		// There is no existing batch, or the existing batch is full; start a new one.
+		d.batch = &batch{
+			db: d,
+		}
+		d.batch.timer = time.AfterFunc(d.opts.MaxBatchDelay, d.batch.trigger)
+	}
+	d.batch.calls = append(d.batch.calls, call{fn: fn, err: errCh})
+	if len(d.batch.calls) >= d.opts.MaxBatchSize {
+		// wake up batch, it's ready to run
+		go d.batch.trigger()
+	}
+	d.batchMu.Unlock()
+	atomic.AddUint64(&d.batchStats.Calls, 1)
+
+	err := <-errCh
+	if err == errTrySolo {
+		atomic.AddUint64(&d.batchStats.SoloCalls, 1)
+		err = d.update(fn)
+	}
+	return err
+}
+
+// BatchStats return the metrics of Batch
+func (d *DB) BatchStats() BatchStats {
+	return BatchStats{
+		Batches:   atomic.LoadUint64(&d.batchStats.Batches),
+		Calls:     atomic.LoadUint64(&d.batchStats.Calls),
+		SoloCalls: atomic.LoadUint64(&d.batchStats.SoloCalls),
+		MaxSize:   atomic.LoadUint64(&d.batchStats.MaxSize),
+		LastSize:  atomic.LoadUint64(&d.batchStats.LastSize),
+	}
+}
+
+// trigger runs the batch if it hasn't already been run.
+func (b *batch) trigger() {
+	b.start.Do(b.run)
+}
+
+// run performs the transactions in the batch and communicates results
+// back to DB.Batch.
+func (b *batch) run() {
+	b.db.batchMu.Lock()
+	b.timer.Stop()
+	// Make sure no new work is added to this batch, but don't break
+	// other batches.
+	if b.db.batch == b {
+		b.db.batch = nil
+	}
+	b.db.batchMu.Unlock()
+
+retry:
+	for len(b.calls) > 0 {
+		var failIdx = -1
+		err := b.db.update(func(tx *Tx) error {
+			for i, c := range b.calls {
+				if err := safelyCall(c.fn, tx); err != nil {
+					failIdx = i
+					return err
+				}
+			}
+			return nil
+		})
+
+		if failIdx >= 0 {
+			// take the failing transaction out of the batch. it's
+			// safe to shorten b.calls here because db.batch no longer
+			// points to us, and we hold the mutex anyway.
+			c := b.calls[failIdx]
+			b.calls[failIdx], b.calls = b.calls[len(b.calls)-1], b.calls[:len(b.calls)-1]
+			// tell the submitter re-run it solo, continue with the rest of the batch
+			c.err <- errTrySolo
+			continue retry
+		}
+
+		b.db.recordBatch(len(b.calls))
+		// pass success, or mdbx internal errors, to all callers
+		for _, c := range b.calls {
+			c.err <- err
+		}
+		break retry
+	}
+}
+
+func (d *DB) recordBatch(size int) {
+	atomic.AddUint64(&d.batchStats.Batches, 1)
+	atomic.StoreUint64(&d.batchStats.LastSize, uint64(size))
+	for {
+		max := atomic.LoadUint64(&d.batchStats.MaxSize)
+		if uint64(size) <= max || atomic.CompareAndSwapUint64(&d.batchStats.MaxSize, max, uint64(size)) {
+			return
+		}
+	}
+}
+
+type panicked struct {
+	reason interface{}
+}
+
+func (p panicked) Error() string {
+	if err, ok := p.reason.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprintf("panic: %v", p.reason)
+}
+
+func safelyCall(fn func(*Tx) error, tx *Tx) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = panicked{p}
+		}
+	}()
+	return fn(tx)
+}
+
+// update run fn in a write transaction bound to the current OS thread, the
+// transaction is committed if fn succeeds and aborted otherwise.
+func (d *DB) update(fn func(*Tx) error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	txn := NewTransaction(d.env)
+	if err := d.env.Begin(txn, TxReadWrite); err != ErrSuccess {
+		return err
+	}
+	if err := fn(txn); err != nil {
+		txn.Abort()
+		return err
+	}
+	if err := txn.Commit(); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
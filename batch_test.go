@@ -0,0 +1,78 @@
+package gmdbx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var dbi DBI
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		dbi, e = tx.OpenDBI("batch", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 64
+	failed := errors.New("failed")
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.Batch(func(tx *Tx) error {
+				if i == 7 {
+					return failed
+				}
+				k := ToVal(uint64(i))
+				if e := tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+					return e
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 7 {
+			assert.Equal(t, failed, err)
+			continue
+		}
+		assert.NoError(t, err)
+	}
+
+	err = db.View(func(tx *Tx) error {
+		var st Stats
+		if e := tx.DBIStat(dbi, &st); e != ErrSuccess {
+			return e
+		}
+		assert.Equal(t, uint64(n-1), st.Entries)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := db.BatchStats()
+	assert.Equal(t, uint64(n), st.Calls)
+	assert.Equal(t, uint64(1), st.SoloCalls)
+	assert.True(t, st.Batches < n, "calls should be coalesced")
+	assert.True(t, st.MaxSize > 1, "calls should be coalesced")
+}
@@ -0,0 +1,302 @@
+package gmdbx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+)
+
+var (
+	ErrBlobClosed = errors.New("blob: reader or writer closed")
+	ErrBadBlob    = errors.New("blob: malformed blob")
+)
+
+// blobMeta chunk index of the record describing a blob
+const blobMeta = ^uint32(0)
+
+// blobKeyRoom bytes of chunk key, index included, left in a page by the
+// default chunk size
+const blobKeyRoom = 64
+
+// BlobOptions configuration of a BlobStore
+type BlobOptions struct {
+	// ChunkSize bytes per chunk, at most MaxDataSize. The default keeps a
+	// chunk and a key of up to blobKeyRoom bytes under half a page, so chunks
+	// never go to overflow pages.
+	ChunkSize int
+	// Hash of the content kept by Stat, default sha256.New
+	Hash func() hash.Hash
+}
+
+// BlobInfo description of a blob
+type BlobInfo struct {
+	Size      int64
+	ChunkSize int
+	Chunks    int
+	Hash      []byte
+}
+
+// BlobStore large values of a table, split in chunks stored under
+// key || chunk index (4 bytes, big-endian) and described by a record under
+// key || 0xffffffff. Like Store it holds no transaction, blobs are written
+// and read inside the transaction given, along with other tables.
+type BlobStore struct {
+	dbi       DBI
+	chunkSize int
+	hash      func() hash.Hash
+}
+
+// NewBlobStore open, or create with DBCreate in flags, the table name inside
+// tx, which must not be DBDupSort.
+func NewBlobStore(tx *Tx, name string, flags DBFlags, opts BlobOptions) (*BlobStore, error) {
+	if flags&DBDupSort != 0 {
+		return nil, ErrIncompatible
+	}
+	if opts.ChunkSize > int(MaxDataSize) {
+		return nil, ErrBadValSize
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = max(tx.env.pairSizeInPage()-blobKeyRoom, 1)
+	}
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	dbi, err := tx.OpenDBI(name, flags)
+	if err != ErrSuccess {
+		return nil, err
+	}
+	return &BlobStore{dbi: dbi, chunkSize: opts.ChunkSize, hash: opts.Hash}, nil
+}
+
+// OpenBlobStore open the table name of the database, creating it if needed
+func OpenBlobStore(d *DB, name string, opts BlobOptions) (*BlobStore, error) {
+	var s *BlobStore
+	err := d.update(func(tx *Tx) (err error) {
+		s, err = NewBlobStore(tx, name, DBCreate, opts)
+		return err
+	})
+	return s, err
+}
+
+// DBI return the handle of the table
+func (s *BlobStore) DBI() DBI {
+	return s.dbi
+}
+
+func chunkKey(dst, key []byte, index uint32) []byte {
+	return binary.BigEndian.AppendUint32(append(dst[:0], key...), index)
+}
+
+// Stat return the description of the blob key, false if it does not exist
+func (s *BlobStore) Stat(tx *Tx, key []byte) (BlobInfo, bool, error) {
+	k, v := bytesVal(chunkKey(nil, key, blobMeta)), Val{}
+	switch err := tx.Get(s.dbi, &k, &v); err {
+	case ErrSuccess:
+	case ErrNotFound:
+		return BlobInfo{}, false, nil
+	default:
+		return BlobInfo{}, false, err
+	}
+	b := v.UnsafeBytes()
+	if len(b) < 16 {
+		return BlobInfo{}, false, ErrBadBlob
+	}
+	info := BlobInfo{
+		Size:      int64(binary.BigEndian.Uint64(b)),
+		ChunkSize: int(binary.BigEndian.Uint32(b[8:])),
+		Chunks:    int(binary.BigEndian.Uint32(b[12:])),
+		Hash:      append([]byte(nil), b[16:]...),
+	}
+	return info, true, nil
+}
+
+// Delete remove the blob key, false if it did not exist
+func (s *BlobStore) Delete(tx *Tx, key []byte) (bool, error) {
+	info, ok, err := s.Stat(tx, key)
+	if !ok || err != nil {
+		return false, err
+	}
+	var buf []byte
+	for i := 0; i <= info.Chunks; i++ {
+		index := uint32(i)
+		if i == info.Chunks {
+			index = blobMeta
+		}
+		buf = chunkKey(buf, key, index)
+		k := bytesVal(buf)
+		if err := tx.Delete(s.dbi, &k, nil); err != ErrSuccess && err != ErrNotFound {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Create return a writer replacing the blob key by what is written. The blob
+// exists once the writer is closed, which must happen before tx commits.
+func (s *BlobStore) Create(tx *Tx, key []byte) (io.WriteCloser, error) {
+	if _, err := s.Delete(tx, key); err != nil {
+		return nil, err
+	}
+	return &blobWriter{
+		s:    s,
+		tx:   tx,
+		key:  append([]byte(nil), key...),
+		buf:  make([]byte, 0, s.chunkSize),
+		hash: s.hash(),
+	}, nil
+}
+
+type blobWriter struct {
+	s      *BlobStore
+	tx     *Tx
+	key    []byte
+	ckey   []byte
+	buf    []byte
+	hash   hash.Hash
+	size   int64
+	chunks uint32
+	closed bool
+}
+
+func (w *blobWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrBlobClosed
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *blobWriter) put(index uint32, data []byte) error {
+	w.ckey = chunkKey(w.ckey, w.key, index)
+	k, v := bytesVal(w.ckey), bytesVal(data)
+	if err := w.tx.Put(w.s.dbi, &k, &v, PutUpsert); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+func (w *blobWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if w.chunks == blobMeta {
+		return ErrBadBlob
+	}
+	if err := w.put(w.chunks, w.buf); err != nil {
+		return err
+	}
+	w.hash.Write(w.buf)
+	w.size += int64(len(w.buf))
+	w.chunks++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close write the last chunk and the description of the blob
+func (w *blobWriter) Close() error {
+	if w.closed {
+		return ErrBlobClosed
+	}
+	w.closed = true
+	if err := w.flush(); err != nil {
+		return err
+	}
+	meta := make([]byte, 16, 16+w.hash.Size())
+	binary.BigEndian.PutUint64(meta, uint64(w.size))
+	binary.BigEndian.PutUint32(meta[8:], uint32(w.s.chunkSize))
+	binary.BigEndian.PutUint32(meta[12:], w.chunks)
+	return w.put(blobMeta, w.hash.Sum(meta))
+}
+
+// Open return a reader of the blob key, ErrNotFound if it does not exist. It
+// is only valid inside tx.
+func (s *BlobStore) Open(tx *Tx, key []byte) (io.ReadSeekCloser, error) {
+	info, ok, err := s.Stat(tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &blobReader{s: s, tx: tx, key: append([]byte(nil), key...), info: info}, nil
+}
+
+type blobReader struct {
+	s      *BlobStore
+	tx     *Tx
+	key    []byte
+	ckey   []byte
+	info   BlobInfo
+	off    int64
+	closed bool
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, ErrBlobClosed
+	}
+	n := 0
+	for n < len(p) && r.off < r.info.Size {
+		size := int64(r.info.ChunkSize)
+		index, within := r.off/size, r.off%size
+		r.ckey = chunkKey(r.ckey, r.key, uint32(index))
+		k, v := bytesVal(r.ckey), Val{}
+		if err := r.tx.Get(r.s.dbi, &k, &v); err != ErrSuccess {
+			if err == ErrNotFound {
+				return n, ErrBadBlob
+			}
+			return n, err
+		}
+		chunk := v.UnsafeBytes()
+		if within >= int64(len(chunk)) {
+			return n, ErrBadBlob
+		}
+		m := copy(p[n:], chunk[within:])
+		n += m
+		r.off += int64(m)
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *blobReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, ErrBlobClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.info.Size
+	default:
+		return 0, ErrEINVAL
+	}
+	if offset < 0 {
+		return 0, ErrEINVAL
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *blobReader) Close() error {
+	if r.closed {
+		return ErrBlobClosed
+	}
+	r.closed = true
+	return nil
+}
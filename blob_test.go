@@ -0,0 +1,158 @@
+package gmdbx
+
+import (
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobStore(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	s, err := OpenBlobStore(db, "blobs", BlobOptions{ChunkSize: 1000})
+	assert.NoError(t, err)
+
+	content := make([]byte, 4500)
+	rand.New(rand.NewSource(1)).Read(content)
+	err = db.update(func(tx *Tx) error {
+		w, err := s.Create(tx, []byte("file"))
+		if err != nil {
+			return err
+		}
+		// writes across chunk boundaries
+		rest := content
+		for _, n := range []int{10, 990, 1500, 2000} {
+			if _, err = w.Write(rest[:n]); err != nil {
+				return err
+			}
+			rest = rest[n:]
+		}
+		return w.Close()
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		info, ok, err := s.Stat(tx, []byte("file"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		sum := sha256.Sum256(content)
+		assert.Equal(t, BlobInfo{Size: 4500, ChunkSize: 1000, Chunks: 5, Hash: sum[:]}, info)
+		_, ok, err = s.Stat(tx, []byte("fil"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		r, err := s.Open(tx, []byte("file"))
+		assert.NoError(t, err)
+		got, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, content, got)
+
+		pos, err := r.Seek(-600, io.SeekEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3900), pos)
+		buf := make([]byte, 200)
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, content[3900:4100], buf)
+		_, err = r.Seek(10, io.SeekCurrent)
+		assert.NoError(t, err)
+		got, err = io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, content[4110:], got)
+		assert.NoError(t, r.Close())
+		_, err = r.Read(buf)
+		assert.ErrorIs(t, err, ErrBlobClosed)
+
+		_, err = s.Open(tx, []byte("missing"))
+		assert.ErrorIs(t, err, ErrNotFound)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// a blob is replaced atomically with the other writes of the transaction
+	err = db.update(func(tx *Tx) error {
+		w, err := s.Create(tx, []byte("file"))
+		if err != nil {
+			return err
+		}
+		w.Write([]byte("short"))
+		w.Close()
+		_, err = w.Write([]byte("more"))
+		assert.ErrorIs(t, err, ErrBlobClosed)
+
+		empty, err := s.Create(tx, []byte("empty"))
+		if err != nil {
+			return err
+		}
+		return empty.Close()
+	})
+	assert.NoError(t, err)
+	keys, _ := loaderContents(t, db, s.DBI())
+	assert.Len(t, keys, 3)
+
+	err = db.update(func(tx *Tx) error {
+		r, err := s.Open(tx, []byte("file"))
+		assert.NoError(t, err)
+		got, _ := io.ReadAll(r)
+		assert.Equal(t, "short", string(got))
+		r, err = s.Open(tx, []byte("empty"))
+		assert.NoError(t, err)
+		got, _ = io.ReadAll(r)
+		assert.Empty(t, got)
+
+		for _, key := range []string{"file", "empty"} {
+			ok, err := s.Delete(tx, []byte(key))
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+		ok, err := s.Delete(tx, []byte("file"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		return nil
+	})
+	assert.NoError(t, err)
+	keys, _ = loaderContents(t, db, s.DBI())
+	assert.Empty(t, keys)
+}
+
+func TestBlobChunkSize(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	_, err = OpenBlobStore(db, "big", BlobOptions{ChunkSize: int(MaxDataSize) + 1})
+	assert.Equal(t, ErrBadValSize, err)
+
+	s, err := OpenBlobStore(db, "blobs", BlobOptions{})
+	assert.NoError(t, err)
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	err = db.update(func(tx *Tx) error {
+		w, err := s.Create(tx, []byte("file"))
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(content); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		var st Stats
+		if e := tx.DBIStat(s.DBI(), &st); e != ErrSuccess {
+			return e
+		}
+		assert.Zero(t, st.OverflowPages)
+		return nil
+	})
+	assert.NoError(t, err)
+}
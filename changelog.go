@@ -0,0 +1,469 @@
+package gmdbx
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+const (
+	// ChangelogTable reserved DBIntegerKey table holding the changelog
+	ChangelogTable = "__changelog"
+	// ChangelogAcksTable reserved table holding the acknowledged transaction
+	// ID of each named consumer
+	ChangelogAcksTable = "__changelog_acks"
+)
+
+var (
+	ErrChangelogEnabled = errors.New("changelog already enabled")
+	ErrBadChangelog     = errors.New("malformed changelog record")
+	ErrNoConsumer       = errors.New("changelog reader has no consumer name")
+)
+
+// ChangelogRecord a write recorded by the changelog
+type ChangelogRecord struct {
+	Seq   uint64 // position in the changelog, increasing
+	TxnID uint64 // ID of the transaction which made the write
+	Table string
+	Op    ChangeOp
+	Key   []byte // nil for ChangeDrop
+	Old   []byte // previous value, nil if the key did not exist
+	New   []byte // written value, nil for deletes
+}
+
+// Changelog durable record of the writes done on a set of tables, appended
+// to ChangelogTable in the writing transaction so it commits or aborts with
+// them. Writes through Tx.Put, Tx.Replace, Tx.Delete and Tx.Drop are
+// recorded, writes through a Cursor are not. For DBDupSort tables Old is the
+// deleted value or the first value of the key.
+type Changelog struct {
+	db     *DB
+	dbi    DBI
+	acks   DBI
+	tables []string
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+type changelogHook struct {
+	cl   *Changelog
+	name string
+}
+
+// changelogState position of a write transaction in the changelog
+type changelogState struct {
+	txnID uint64
+	seq   uint64
+}
+
+// EnableChangelog record the writes done on tables from now on, the tables
+// are created if needed, and recorded again when deleted and created anew.
+// It must be called again each time the database is opened.
+func (d *DB) EnableChangelog(tables ...string) (*Changelog, error) {
+	d.changelogMu.Lock()
+	defer d.changelogMu.Unlock()
+	if d.changelog != nil {
+		return nil, ErrChangelogEnabled
+	}
+
+	cl := &Changelog{db: d, tables: append([]string(nil), tables...), wake: make(chan struct{})}
+	dbis := make([]DBI, len(tables))
+	err := d.update(func(tx *Tx) error {
+		var err Error
+		if cl.dbi, err = tx.OpenDBI(ChangelogTable, DBCreate|DBIntegerKey); err != ErrSuccess {
+			return err
+		}
+		if cl.acks, err = tx.OpenDBI(ChangelogAcksTable, DBCreate); err != ErrSuccess {
+			return err
+		}
+		for i, name := range tables {
+			if dbis[i], err = tx.OpenDBI(name, DBCreate); err != ErrSuccess {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range tables {
+		d.env.addTableHook(dbis[i], name, &changelogHook{cl: cl, name: name})
+	}
+	d.changelog = cl
+	return cl, nil
+}
+
+// Tables return the names of the recorded tables
+func (cl *Changelog) Tables() []string {
+	return append([]string(nil), cl.tables...)
+}
+
+func (h *changelogHook) check(tx *Tx, c *change) Error {
+	return ErrSuccess
+}
+
+func (h *changelogHook) apply(tx *Tx, c *change) Error {
+	op := ChangePut
+	if !c.hasNew {
+		op = ChangeDelete
+	}
+	return h.cl.append(tx, h.name, op, c)
+}
+
+func (h *changelogHook) drop(tx *Tx, dbi DBI) Error {
+	return h.cl.append(tx, h.name, ChangeDrop, &change{dbi: dbi})
+}
+
+const (
+	changelogHasOld = 1 << 0
+	changelogHasNew = 1 << 1
+)
+
+// append add a record, the first one of a transaction looks up the last
+// sequence number and arranges for readers to be woken after the commit.
+func (cl *Changelog) append(tx *Tx, table string, op ChangeOp, c *change) Error {
+	st := &tx.changelog
+	if st.txnID == 0 {
+		cur, err := tx.OpenCursor(cl.dbi)
+		if err != ErrSuccess {
+			return err
+		}
+		var k, v Val
+		err = cur.Get(&k, &v, CursorLast)
+		cur.Close()
+		switch err {
+		case ErrSuccess:
+			st.seq = k.U64()
+		case ErrNotFound:
+			st.seq = 0
+		default:
+			return err
+		}
+		st.txnID = tx.ID()
+		tx.OnCommit(cl.notify)
+	}
+	st.seq++
+
+	var flags byte
+	if c.hasOld {
+		flags |= changelogHasOld
+	}
+	if c.hasNew {
+		flags |= changelogHasNew
+	}
+	b := make([]byte, 0, 8+2+3*binary.MaxVarintLen32+len(table)+len(c.key)+len(c.old)+len(c.new))
+	b = binary.BigEndian.AppendUint64(b, st.txnID)
+	b = append(b, byte(op), flags)
+	for _, field := range [][]byte{[]byte(table), c.key, c.old} {
+		b = binary.AppendUvarint(b, uint64(len(field)))
+		b = append(b, field...)
+	}
+	b = append(b, c.new...)
+
+	k, v := ToVal(st.seq), bytesVal(b)
+	return tx.put(cl.dbi, &k, &v, PutAppend)
+}
+
+func decodeChangelog(seq uint64, b []byte) (ChangelogRecord, error) {
+	r := ChangelogRecord{Seq: seq}
+	if len(b) < 10 {
+		return r, ErrBadChangelog
+	}
+	r.TxnID = binary.BigEndian.Uint64(b)
+	r.Op = ChangeOp(b[8])
+	flags := b[9]
+	b = b[10:]
+
+	var fields [3][]byte
+	for i := range fields {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < n {
+			return r, ErrBadChangelog
+		}
+		fields[i] = append([]byte{}, b[size:size+int(n)]...)
+		b = b[size+int(n):]
+	}
+	r.Table = string(fields[0])
+	if r.Op != ChangeDrop {
+		r.Key = fields[1]
+	}
+	if flags&changelogHasOld != 0 {
+		r.Old = fields[2]
+	}
+	if flags&changelogHasNew != 0 {
+		r.New = append([]byte{}, b...)
+	}
+	return r, nil
+}
+
+// notify wake the readers waiting for new records
+func (cl *Changelog) notify(uint64) {
+	cl.mu.Lock()
+	close(cl.wake)
+	cl.wake = make(chan struct{})
+	cl.mu.Unlock()
+}
+
+func (cl *Changelog) waiter() <-chan struct{} {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.wake
+}
+
+// view run fn in a read-only transaction bound to the current OS thread
+func (cl *Changelog) view(fn func(tx *Tx) error) error {
+	return cl.db.ViewContext(context.Background(), fn)
+}
+
+// Truncate delete the records of transactions before txnID, the latest
+// record is always kept so sequence numbers keep increasing. It returns the
+// number of deleted records.
+func (cl *Changelog) Truncate(before uint64) (int, error) {
+	deleted := 0
+	err := cl.db.update(func(tx *Tx) error {
+		cur, err := tx.OpenCursor(cl.dbi)
+		if err != ErrSuccess {
+			return err
+		}
+		defer cur.Close()
+
+		var k, v, last Val
+		if err = cur.Get(&last, &v, CursorLast); err != ErrSuccess {
+			if err == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		lastSeq := last.U64()
+		var truncated uint64
+		for err = cur.Get(&k, &v, CursorFirst); err == ErrSuccess; err = cur.Get(&k, &v, CursorNext) {
+			// after Delete the cursor is on the following record, which Next returns
+			if k.U64() == lastSeq || len(v.UnsafeBytes()) < 8 {
+				break
+			}
+			id := binary.BigEndian.Uint64(v.UnsafeBytes())
+			if id >= before {
+				break
+			}
+			if err = cur.Delete(0); err != ErrSuccess {
+				return err
+			}
+			truncated = id
+			deleted++
+		}
+		if err != ErrSuccess && err != ErrNotFound {
+			return err
+		}
+		if deleted == 0 {
+			return nil
+		}
+		return cl.setTruncated(tx, truncated)
+	})
+	return deleted, err
+}
+
+// the acknowledgement of the unnamed consumer, which can not acknowledge,
+// holds the ID of the last transaction whose records were truncated
+var truncatedKey = []byte{}
+
+func (cl *Changelog) setTruncated(tx *Tx, txnID uint64) error {
+	k := bytesVal(truncatedKey)
+	v := bytesVal(binary.BigEndian.AppendUint64(nil, txnID))
+	if err := tx.Put(cl.acks, &k, &v, PutUpsert); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+// Truncated return the ID of the last transaction whose records were deleted
+// by Truncate, 0 if none. Readers starting at or before it missed records.
+func (cl *Changelog) Truncated() (uint64, error) {
+	return cl.Acked(string(truncatedKey))
+}
+
+// TruncateAcked delete the records acknowledged by every consumer, nothing
+// is deleted while no consumer acknowledged.
+func (cl *Changelog) TruncateAcked() (int, error) {
+	var min uint64
+	found := false
+	err := cl.view(func(tx *Tx) error {
+		return tx.ForEach(cl.acks, func(k, v []byte) error {
+			if len(k) == 0 {
+				return nil
+			}
+			if len(v) != 8 {
+				return ErrBadChangelog
+			}
+			if id := binary.BigEndian.Uint64(v); !found || id < min {
+				min = id
+			}
+			found = true
+			return nil
+		})
+	})
+	if err != nil || !found {
+		return 0, err
+	}
+	return cl.Truncate(min + 1)
+}
+
+// Acked return the last transaction ID acknowledged by consumer, 0 if none
+func (cl *Changelog) Acked(consumer string) (uint64, error) {
+	var id uint64
+	err := cl.view(func(tx *Tx) error {
+		k, v := bytesVal([]byte(consumer)), Val{}
+		switch err := tx.Get(cl.acks, &k, &v); err {
+		case ErrSuccess:
+			if v.Len != 8 {
+				return ErrBadChangelog
+			}
+			id = binary.BigEndian.Uint64(v.UnsafeBytes())
+		case ErrNotFound:
+		default:
+			return err
+		}
+		return nil
+	})
+	return id, err
+}
+
+// ChangelogReader reads the changelog in order and waits for new records
+// once it reached the end. It is not safe for concurrent use.
+type ChangelogReader struct {
+	cl       *Changelog
+	consumer string
+	from     uint64
+	next     uint64
+	buf      []ChangelogRecord
+}
+
+// NewReader read the records of transactions from fromTxnID on. A named
+// consumer without fromTxnID resumes after the transaction it acknowledged.
+func (cl *Changelog) NewReader(consumer string, fromTxnID uint64) (*ChangelogReader, error) {
+	r := &ChangelogReader{cl: cl, consumer: consumer, from: fromTxnID}
+	if consumer != "" && fromTxnID == 0 {
+		acked, err := cl.Acked(consumer)
+		if err != nil {
+			return nil, err
+		}
+		if acked > 0 {
+			r.from = acked + 1
+		}
+	}
+	return r, nil
+}
+
+// Next return the next record, waiting for one to be committed until ctx is
+// done.
+func (r *ChangelogReader) Next(ctx context.Context) (ChangelogRecord, error) {
+	for {
+		if len(r.buf) > 0 {
+			rec := r.buf[0]
+			r.buf = r.buf[1:]
+			return rec, nil
+		}
+		// taken before reading, so a commit in between is not missed
+		wake := r.cl.waiter()
+		if err := r.cl.view(r.fill); err != nil {
+			return ChangelogRecord{}, err
+		}
+		if len(r.buf) > 0 {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ChangelogRecord{}, ctx.Err()
+		}
+	}
+}
+
+// Ack persist that the consumer processed the records of transactions up to
+// txnID, they may then be removed by TruncateAcked.
+func (r *ChangelogReader) Ack(txnID uint64) error {
+	if r.consumer == "" {
+		return ErrNoConsumer
+	}
+	return r.cl.db.update(func(tx *Tx) error {
+		k := bytesVal([]byte(r.consumer))
+		v := bytesVal(binary.BigEndian.AppendUint64(nil, txnID))
+		if err := tx.Put(r.cl.acks, &k, &v, PutUpsert); err != ErrSuccess {
+			return err
+		}
+		return nil
+	})
+}
+
+const changelogBatch = 256
+
+func (r *ChangelogReader) fill(tx *Tx) error {
+	cur, err := tx.OpenCursor(r.cl.dbi)
+	if err != ErrSuccess {
+		return err
+	}
+	defer cur.Close()
+
+	if r.next == 0 {
+		seq, err := r.locate(cur)
+		if err != nil || seq == 0 {
+			return err
+		}
+		r.next = seq
+	}
+
+	k, v := ToVal(r.next), Val{}
+	for err = cur.Get(&k, &v, CursorSetRange); err == ErrSuccess; err = cur.Get(&k, &v, CursorNext) {
+		rec, e := decodeChangelog(k.U64(), v.UnsafeBytes())
+		if e != nil {
+			return e
+		}
+		r.next = rec.Seq + 1
+		r.buf = append(r.buf, rec)
+		if len(r.buf) == changelogBatch {
+			return nil
+		}
+	}
+	if err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// locate binary search the first record of a transaction at or after from,
+// sequence numbers and transaction IDs grow together. 0 is returned for an
+// empty changelog.
+func (r *ChangelogReader) locate(cur *Cursor) (uint64, error) {
+	var k, v Val
+	err := cur.Get(&k, &v, CursorFirst)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != ErrSuccess {
+		return 0, err
+	}
+	lo := k.U64()
+	if err = cur.Get(&k, &v, CursorLast); err != ErrSuccess {
+		return 0, err
+	}
+	hi := k.U64() + 1
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		k = ToVal(mid)
+		if err = cur.Get(&k, &v, CursorSetRange); err != ErrSuccess {
+			return 0, err
+		}
+		if len(v.UnsafeBytes()) < 8 {
+			return 0, ErrBadChangelog
+		}
+		if binary.BigEndian.Uint64(v.UnsafeBytes()) < r.from {
+			lo = k.U64() + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
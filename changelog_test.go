@@ -0,0 +1,202 @@
+package gmdbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangelog(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	cl, err := db.EnableChangelog("users", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.EnableChangelog("users")
+	assert.Equal(t, ErrChangelogEnabled, err)
+
+	users := openLoaderDBI(t, db, "users", 0)
+	orders := openLoaderDBI(t, db, "orders", 0)
+	plain := openLoaderDBI(t, db, "plain", DBCreate)
+
+	first := watchWrite(t, db, func(tx *Tx) error {
+		indexPut(tx, users, "u1", "ann")
+		indexPut(tx, users, "u1", "bob")
+		indexPut(tx, plain, "p", "not recorded")
+		indexPut(tx, orders, "o1", "")
+		return nil
+	})
+	second := watchWrite(t, db, func(tx *Tx) error {
+		k := bytesVal([]byte("u1"))
+		tx.Delete(users, &k, nil)
+		tx.Drop(orders, false)
+		return nil
+	})
+	// aborted writes leave no record
+	db.update(func(tx *Tx) error {
+		indexPut(tx, users, "u2", "x")
+		return ErrNotFound
+	})
+
+	r, err := cl.NewReader("", 0)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var recs []ChangelogRecord
+	for i := 0; i < 5; i++ {
+		rec, err := r.Next(ctx)
+		assert.NoError(t, err)
+		recs = append(recs, rec)
+	}
+	assert.Equal(t, []ChangelogRecord{
+		{Seq: 1, TxnID: first, Table: "users", Op: ChangePut, Key: []byte("u1"), New: []byte("ann")},
+		{Seq: 2, TxnID: first, Table: "users", Op: ChangePut, Key: []byte("u1"), Old: []byte("ann"), New: []byte("bob")},
+		{Seq: 3, TxnID: first, Table: "orders", Op: ChangePut, Key: []byte("o1"), New: []byte{}},
+		{Seq: 4, TxnID: second, Table: "users", Op: ChangeDelete, Key: []byte("u1"), Old: []byte("bob")},
+		{Seq: 5, TxnID: second, Table: "orders", Op: ChangeDrop},
+	}, recs)
+
+	// the reader waits for the next commit
+	committed := make(chan uint64, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		committed <- watchWrite(t, db, func(tx *Tx) error {
+			indexPut(tx, users, "u3", "cid")
+			return nil
+		})
+	}()
+	rec, err := r.Next(ctx)
+	assert.NoError(t, err)
+	third := <-committed
+	assert.Equal(t, uint64(6), rec.Seq)
+	assert.Equal(t, third, rec.TxnID)
+
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	_, err = r.Next(short)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// a reader starting at a transaction skips the earlier records
+	r, err = cl.NewReader("cache", second)
+	assert.NoError(t, err)
+	rec, err = r.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), rec.Seq)
+
+	noName, _ := cl.NewReader("", 0)
+	assert.Equal(t, ErrNoConsumer, noName.Ack(first))
+
+	// nothing is truncated until consumers acknowledge
+	n, err := cl.TruncateAcked()
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	truncated, err := cl.Truncated()
+	assert.NoError(t, err)
+	assert.Zero(t, truncated)
+
+	assert.NoError(t, r.Ack(second))
+	acked, err := cl.Acked("cache")
+	assert.NoError(t, err)
+	assert.Equal(t, second, acked)
+	n, err = cl.TruncateAcked()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	truncated, err = cl.Truncated()
+	assert.NoError(t, err)
+	assert.Equal(t, second, truncated)
+
+	// resuming after the acknowledged transaction
+	r, err = cl.NewReader("cache", 0)
+	assert.NoError(t, err)
+	rec, err = r.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), rec.Seq)
+
+	// the latest record is kept, so sequence numbers keep growing
+	n, err = cl.Truncate(third + 1)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	watchWrite(t, db, func(tx *Tx) error {
+		indexPut(tx, users, "u4", "dan")
+		return nil
+	})
+	rec, err = r.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), rec.Seq)
+}
+
+func TestChangelogRecreatedTable(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	cl, err := db.EnableChangelog("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := openLoaderDBI(t, db, "users", 0)
+	drop := func(recreate bool) {
+		err := db.update(func(tx *Tx) error {
+			indexPut(tx, users, "u1", "ann")
+			if e := tx.Drop(users, true); e != ErrSuccess {
+				return e
+			}
+			if recreate {
+				var e Error
+				if users, e = tx.OpenDBI("users", DBCreate); e != ErrSuccess {
+					return e
+				}
+				indexPut(tx, users, "u2", "bob")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	// deleted then created in another transaction
+	drop(false)
+	users = openLoaderDBI(t, db, "users", DBCreate)
+	err = db.update(func(tx *Tx) error {
+		indexPut(tx, users, "u3", "cid")
+		return nil
+	})
+	assert.NoError(t, err)
+	// deleted and created in the same transaction
+	drop(true)
+	err = db.update(func(tx *Tx) error {
+		indexPut(tx, users, "u4", "dan")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	r, err := cl.NewReader("", 0)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	type write struct {
+		op  ChangeOp
+		key string
+	}
+	var writes []write
+	for i := 0; i < 7; i++ {
+		rec, err := r.Next(ctx)
+		if !assert.NoError(t, err) {
+			break
+		}
+		writes = append(writes, write{rec.Op, string(rec.Key)})
+	}
+	assert.Equal(t, []write{
+		{ChangePut, "u1"}, {ChangeDrop, ""}, {ChangePut, "u3"},
+		{ChangePut, "u1"}, {ChangeDrop, ""}, {ChangePut, "u2"}, {ChangePut, "u4"},
+	}, writes)
+	assert.Equal(t, []string{"users"}, cl.Tables())
+}
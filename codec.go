@@ -0,0 +1,159 @@
+package gmdbx
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"unsafe"
+
+	"github.com/sunvim/gmdbx/keys"
+)
+
+var ErrCodecSize = errors.New("codec: encoded value has a bad size")
+
+// Codec converts values of a Store to and from bytes. Decode gets memory of
+// the database, valid only during the transaction, it must copy what it keeps.
+type Codec[T any] interface {
+	// Encode append the encoding of v to dst
+	Encode(dst []byte, v T) ([]byte, error)
+	Decode(b []byte) (T, error)
+}
+
+// Integer types supported by IntCodec
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// IntCodec big-endian integers of the width of T, signed ones with the sign
+// bit flipped, so keys sort numerically with the default comparator.
+type IntCodec[T Integer] struct{}
+
+func (IntCodec[T]) layout() (size int, signed bool) {
+	var zero T
+	return int(unsafe.Sizeof(zero)), ^zero < 0
+}
+
+func (c IntCodec[T]) Encode(dst []byte, v T) ([]byte, error) {
+	size, signed := c.layout()
+	u := uint64(v)
+	if signed {
+		u ^= 1 << (size*8 - 1)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(dst, buf[8-size:]...), nil
+}
+
+func (c IntCodec[T]) Decode(b []byte) (T, error) {
+	size, signed := c.layout()
+	if len(b) != size {
+		return 0, ErrCodecSize
+	}
+	var buf [8]byte
+	copy(buf[8-size:], b)
+	u := binary.BigEndian.Uint64(buf[:])
+	if !signed {
+		return T(u), nil
+	}
+	shift := 64 - size*8
+	u ^= 1 << (size*8 - 1)
+	return T(int64(u<<shift) >> shift), nil
+}
+
+// FloatCodec float64 in IEEE 754 total order, see keys.AppendFloat64
+type FloatCodec struct{}
+
+func (FloatCodec) Encode(dst []byte, v float64) ([]byte, error) {
+	return keys.AppendFloat64(dst, v), nil
+}
+
+func (FloatCodec) Decode(b []byte) (float64, error) {
+	if len(b) != 8 {
+		return 0, ErrCodecSize
+	}
+	return keys.Float64(b), nil
+}
+
+// StringCodec raw bytes of a string
+type StringCodec struct{}
+
+func (StringCodec) Encode(dst []byte, v string) ([]byte, error) {
+	return append(dst, v...), nil
+}
+
+func (StringCodec) Decode(b []byte) (string, error) {
+	return string(b), nil
+}
+
+// BytesCodec byte slices stored as is, decoded values are copies
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(dst []byte, v []byte) ([]byte, error) {
+	return append(dst, v...), nil
+}
+
+func (BytesCodec) Decode(b []byte) ([]byte, error) {
+	return append([]byte{}, b...), nil
+}
+
+// JSONCodec values encoded with encoding/json
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(dst []byte, v T) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, b...), nil
+}
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec values encoded with encoding/gob, each value carries its type
+// description so it can be decoded on its own.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(dst []byte, v T) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// BinaryCodec values implementing encoding.BinaryMarshaler and, through
+// their pointer P, encoding.BinaryUnmarshaler. UnmarshalBinary gets a copy
+// of the stored bytes, as implementations may keep it.
+type BinaryCodec[T any, P interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}] struct{}
+
+func (BinaryCodec[T, P]) Encode(dst []byte, v T) ([]byte, error) {
+	b, err := P(&v).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, b...), nil
+}
+
+func (BinaryCodec[T, P]) Decode(b []byte) (T, error) {
+	var v T
+	err := P(&v).UnmarshalBinary(append([]byte{}, b...))
+	return v, err
+}
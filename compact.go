@@ -0,0 +1,708 @@
+package gmdbx
+
+//#include "mdbxgo.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/sunvim/gmdbx/unsafecgo"
+)
+
+// compactSuffix of the compacted copy, next to the data file
+const compactSuffix = ".compact"
+
+// compactCopied called by tests once the first copy is written
+var compactCopied func()
+
+type capturedKind uint8
+
+const (
+	capturedPut capturedKind = iota
+	capturedReplace
+	capturedDelete
+	capturedDrop
+	capturedCanary
+)
+
+// capturedOp a write done by a transaction while a compaction copies the
+// database, replayed on the copy
+type capturedOp struct {
+	kind    capturedKind
+	dbi     DBI
+	flags   PutFlags
+	del     bool
+	key     []byte
+	data    []byte
+	hasData bool
+	old     []byte // replace, oldData given to the call
+	hasOld  bool
+	canary  *Canary
+}
+
+type compactTxn struct {
+	ops        []capturedOp
+	incomplete bool
+}
+
+// compactLog writes of the transactions committed during a compaction, by
+// transaction ID
+type compactLog struct {
+	mu   sync.Mutex
+	txns map[uint64]*compactTxn
+}
+
+func (l *compactLog) add(id uint64, ops []capturedOp, incomplete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.txns[id]
+	if t == nil {
+		// a write transaction committing nothing does not consume its ID,
+		// the next one reuses it
+		t = &compactTxn{}
+		l.txns[id] = t
+	}
+	t.ops = append(t.ops, ops...)
+	t.incomplete = t.incomplete || incomplete
+}
+
+// take remove the transactions from from on, until the first missing one.
+// It reports false when one of them could not be recorded completely.
+func (l *compactLog) take(from uint64) ([]*compactTxn, uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var txns []*compactTxn
+	for ; ; from++ {
+		t := l.txns[from]
+		if t == nil {
+			return txns, from, true
+		}
+		if t.incomplete {
+			return nil, from, false
+		}
+		delete(l.txns, from)
+		txns = append(txns, t)
+	}
+}
+
+func copyVal(v *Val) ([]byte, bool) {
+	if v == nil {
+		return nil, false
+	}
+	return v.Bytes(), true
+}
+
+func (tx *Tx) capturePut(dbi DBI, key, data *Val, flags PutFlags) {
+	if flags&(PutReserve|PutMultiple) != 0 {
+		tx.uncaptured = true
+		return
+	}
+	op := capturedOp{kind: capturedPut, dbi: dbi, flags: flags, key: key.Bytes()}
+	op.data, op.hasData = copyVal(data)
+	tx.captured = append(tx.captured, op)
+}
+
+func (tx *Tx) captureReplace(dbi DBI, key, data *Val, old []byte, flags PutFlags) {
+	if flags&(PutReserve|PutMultiple) != 0 {
+		tx.uncaptured = true
+		return
+	}
+	op := capturedOp{kind: capturedReplace, dbi: dbi, flags: flags, key: key.Bytes(), old: old, hasOld: old != nil}
+	op.data, op.hasData = copyVal(data)
+	tx.captured = append(tx.captured, op)
+}
+
+func (tx *Tx) captureDelete(dbi DBI, key, data *Val) {
+	op := capturedOp{kind: capturedDelete, dbi: dbi, key: key.Bytes()}
+	op.data, op.hasData = copyVal(data)
+	tx.captured = append(tx.captured, op)
+}
+
+func (tx *Tx) captureDrop(dbi DBI, del bool) {
+	tx.captured = append(tx.captured, capturedOp{kind: capturedDrop, dbi: dbi, del: del})
+}
+
+func (tx *Tx) captureCanary(canary *Canary) {
+	op := capturedOp{kind: capturedCanary}
+	if canary != nil {
+		c := *canary
+		op.canary = &c
+	}
+	tx.captured = append(tx.captured, op)
+}
+
+// captureCursor mark the writes of the transaction as not recorded when one
+// was done through the cursor of ctx
+func (tx *Tx) captureCursor(ctx *C.cursor_ctx) {
+	if tx.capture != nil && ctx.wrote != 0 {
+		tx.uncaptured = true
+	}
+}
+
+// captureBind mark the writes of the transaction as not recorded when a
+// cursor not opened by it is bound, its writes cannot be seen
+func (tx *Tx) captureBind() {
+	if tx.capture != nil {
+		tx.uncaptured = true
+	}
+}
+
+// captureCommit hand the writes of a committed transaction to the compaction
+func (tx *Tx) captureCommit(id uint64, result Error) {
+	if tx.capture != nil && result == ErrSuccess && (len(tx.captured) > 0 || tx.uncaptured) {
+		tx.capture.add(id, tx.captured, tx.uncaptured)
+	}
+	tx.clearCapture()
+}
+
+func (tx *Tx) clearCapture() {
+	tx.capture = nil
+	tx.captured = nil
+	tx.uncaptured = false
+}
+
+func replay(tx *Tx, txns []*compactTxn) Error {
+	for _, t := range txns {
+		for i := range t.ops {
+			op := &t.ops[i]
+			k := bytesVal(op.key)
+			var data *Val
+			if op.hasData {
+				v := bytesVal(op.data)
+				data = &v
+			}
+			var err Error
+			switch op.kind {
+			case capturedPut:
+				err = tx.put(op.dbi, &k, data, op.flags)
+			case capturedReplace:
+				var old *Val
+				if op.hasOld {
+					v := Val{}
+					if len(op.old) > 0 {
+						// replace may write the previous value in place
+						v = bytesVal(slices.Clone(op.old))
+					}
+					old = &v
+				}
+				err = tx.replace(op.dbi, &k, data, old, op.flags)
+			case capturedDelete:
+				err = tx.delete(op.dbi, &k, data)
+			case capturedDrop:
+				err = tx.drop(op.dbi, op.del)
+			case capturedCanary:
+				err = tx.putCanary(op.canary)
+			}
+			if err != ErrSuccess {
+				return err
+			}
+		}
+	}
+	return ErrSuccess
+}
+
+// How a transaction is counted by the compaction gate of its Env. Write
+// transactions take gateMu, read transactions only an atomic counter and
+// take gateMu while Compact swaps the files.
+const (
+	gateNone uint8 = iota
+	gateReader
+	gateWriter
+)
+
+func (env *Env) cond() *sync.Cond {
+	if env.gate == nil {
+		env.gate = sync.NewCond(&env.gateMu)
+	}
+	return env.gate
+}
+
+// enter wait for a running compaction and count a new transaction
+func (env *Env) enter(write bool) uint8 {
+	if !write {
+		for {
+			env.readers.Add(1)
+			if !env.swapping.Load() {
+				return gateReader
+			}
+			env.leaveReader()
+			env.gateMu.Lock()
+			for env.swapping.Load() {
+				env.cond().Wait()
+			}
+			env.gateMu.Unlock()
+		}
+	}
+	env.gateMu.Lock()
+	for env.swapping.Load() {
+		env.cond().Wait()
+	}
+	env.writers++
+	env.gateMu.Unlock()
+	return gateWriter
+}
+
+func (env *Env) leaveReader() {
+	if env.readers.Add(-1) == 0 && env.swapping.Load() {
+		env.gateMu.Lock()
+		env.cond().Broadcast()
+		env.gateMu.Unlock()
+	}
+}
+
+func (tx *Tx) leave() {
+	env := tx.env
+	switch tx.gated {
+	case gateReader:
+		env.leaveReader()
+	case gateWriter:
+		env.gateMu.Lock()
+		env.writers--
+		if env.writers == 0 && env.swapping.Load() {
+			env.cond().Broadcast()
+		}
+		env.gateMu.Unlock()
+	}
+	tx.gated = gateNone
+}
+
+// closeGate block new transactions and wait for the running ones to end
+func (env *Env) closeGate(ctx context.Context) error {
+	env.gateMu.Lock()
+	defer env.gateMu.Unlock()
+	env.swapping.Store(true)
+	stop := context.AfterFunc(ctx, func() {
+		env.gateMu.Lock()
+		env.cond().Broadcast()
+		env.gateMu.Unlock()
+	})
+	defer stop()
+	for env.writers > 0 || env.readers.Load() > 0 {
+		if err := ctx.Err(); err != nil {
+			env.swapping.Store(false)
+			env.cond().Broadcast()
+			return err
+		}
+		env.cond().Wait()
+	}
+	return nil
+}
+
+func (env *Env) openGate() {
+	env.gateMu.Lock()
+	env.swapping.Store(false)
+	env.cond().Broadcast()
+	env.gateMu.Unlock()
+}
+
+// registerPool and unregisterPool keep the read pools of env, whose idle
+// transactions are aborted before Compact closes the environment.
+func (env *Env) registerPool(p *ReadPool) {
+	env.poolsMu.Lock()
+	if env.pools == nil {
+		env.pools = make(map[*ReadPool]struct{})
+	}
+	env.pools[p] = struct{}{}
+	env.poolsMu.Unlock()
+}
+
+func (env *Env) unregisterPool(p *ReadPool) {
+	env.poolsMu.Lock()
+	delete(env.pools, p)
+	env.poolsMu.Unlock()
+}
+
+func (env *Env) dropIdleReaders() {
+	env.poolsMu.Lock()
+	pools := make([]*ReadPool, 0, len(env.pools))
+	for p := range env.pools {
+		pools = append(pools, p)
+	}
+	env.poolsMu.Unlock()
+	for _, p := range pools {
+		p.dropIdle()
+	}
+}
+
+func (env *Env) nameDBI(dbi DBI, name string) {
+	env.namesMu.Lock()
+	if env.names == nil {
+		env.names = map[DBI]string{}
+	}
+	env.names[dbi] = name
+	env.namesMu.Unlock()
+}
+
+func (env *Env) forgetDBI(dbi DBI) {
+	env.namesMu.Lock()
+	delete(env.names, dbi)
+	env.namesMu.Unlock()
+}
+
+type namedDBI struct {
+	dbi   DBI
+	name  string
+	flags DBFlags
+}
+
+// namedDBIs return the open handles in order, with the flags of their table.
+// Handles left by an aborted transaction creating their table are forgotten.
+func (env *Env) namedDBIs() ([]namedDBI, error) {
+	env.namesMu.Lock()
+	var dbis []namedDBI
+	for dbi, name := range env.names {
+		dbis = append(dbis, namedDBI{dbi: dbi, name: name})
+	}
+	env.namesMu.Unlock()
+	sort.Slice(dbis, func(i, j int) bool { return dbis[i].dbi < dbis[j].dbi })
+
+	kept := dbis[:0]
+	err := env.rawTxn(TxReadOnly, func(tx *Tx) Error {
+		for _, d := range dbis {
+			flags, _, err := tx.DBIFlags(d.dbi)
+			if err == ErrBadDBI {
+				env.forgetDBI(d.dbi)
+				continue
+			}
+			if err != ErrSuccess {
+				return err
+			}
+			d.flags = flags & dbPersistentFlags
+			kept = append(kept, d)
+		}
+		return ErrSuccess
+	})
+	if err != ErrSuccess {
+		return nil, err
+	}
+	return kept, nil
+}
+
+// dbPersistentFlags flags of a table stored in the database
+const dbPersistentFlags = DBReverseKey | DBDupSort | DBIntegerKey | DBDupFixed | DBIntegerGroup | DBReverseDup
+
+// openDBIs open the handles of dbis from the first one not open yet, they must
+// get the same numbers as in the compacted environment.
+func openDBIs(tx *Tx, dbis []namedDBI, create bool) Error {
+	for _, d := range dbis {
+		flags := d.flags
+		if create {
+			flags |= DBCreate
+		}
+		var dbi DBI
+		n := C.CString(d.name)
+		err := Error(C.mdbx_dbi_open(tx.txn, n, (C.MDBX_db_flags_t)(flags), (*C.MDBX_dbi)(unsafe.Pointer(&dbi))))
+		C.free(unsafe.Pointer(n))
+		if err != ErrSuccess {
+			return err
+		}
+		if dbi != d.dbi {
+			return ErrIncompatible
+		}
+	}
+	return ErrSuccess
+}
+
+// rawTxn run fn in a transaction which ignores the compaction gate
+func (env *Env) rawTxn(flags TxFlags, fn func(tx *Tx) Error) Error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	tx := NewTransaction(env)
+	if err := env.begin(tx, flags); err != ErrSuccess {
+		return err
+	}
+	if err := fn(tx); err != ErrSuccess {
+		tx.Abort()
+		return err
+	}
+	return tx.Commit()
+}
+
+// envInfo information on the environment outside of a transaction
+func (env *Env) envInfo(info *EnvInfo) Error {
+	args := struct {
+		env    uintptr
+		txn    uintptr
+		info   uintptr
+		size   uintptr
+		result int32
+	}{
+		env:  uintptr(unsafe.Pointer(env.env)),
+		info: uintptr(unsafe.Pointer(info)),
+		size: unsafe.Sizeof(C.MDBX_envinfo{}),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_env_info_ex), ptr, 0)
+	return Error(args.result)
+}
+
+// Shrink reduce the data file to the pages in use, which only reclaims free
+// pages at its tail, Compact reclaims the others. It returns the number of
+// bytes the file shrank by.
+func (env *Env) Shrink() (uint64, Error) {
+	var info EnvInfo
+	if err := env.envInfo(&info); err != ErrSuccess {
+		return 0, err
+	}
+	used := (info.LastPageNumber + 1) * uint64(info.DXBPageSize)
+	used = max(used, info.Geo.Lower)
+	if used >= info.Geo.Current {
+		return 0, ErrSuccess
+	}
+	keep := ^uintptr(0) // -1, keep the current value
+	err := env.SetGeometry(Geometry{
+		SizeLower:       keep,
+		SizeNow:         uintptr(used),
+		SizeUpper:       keep,
+		GrowthStep:      keep,
+		ShrinkThreshold: keep,
+		PageSize:        keep,
+	})
+	if err != ErrSuccess {
+		return 0, err
+	}
+	before := info.Geo.Current
+	if err = env.envInfo(&info); err != ErrSuccess {
+		return 0, err
+	}
+	if info.Geo.Current >= before {
+		return 0, ErrSuccess
+	}
+	return before - info.Geo.Current, ErrSuccess
+}
+
+// dataFile path of the data file of the database
+func (d *DB) dataFile() string {
+	if d.opts.Flags&EnvNoSubDir != 0 {
+		return d.opts.Path
+	}
+	return filepath.Join(d.opts.Path, "mdbx.dat")
+}
+
+// Compact rewrite the database without its free pages and replace the data
+// file with the result, which also shrinks it.
+//
+// The compacted copy is written next to the data file while transactions go
+// on, the writes committed meanwhile are recorded and replayed on the copy.
+// New transactions then wait while the last writes are replayed and the
+// environment is reopened on the copy. Writes which cannot be replayed, done
+// through a Cursor or with PutReserve, are handled by copying the database
+// again at that point, which blocks transactions for longer. Only write
+// transactions take a lock when they begin and end, read transactions are
+// counted atomically and wait only while Compact holds the gate.
+//
+// Running transactions, open Snapshots included, map the old data file and
+// must end before the files are swapped, Compact gives up when ctx is done.
+// The idle transactions of a ReadPool are aborted instead, and a transaction
+// reset by its caller fails to renew with ErrBadTXN. Compact must not be
+// called from a transaction, and the database must not be used by other
+// processes. DBI handles stay valid, unless one closed with CloseDBI left a
+// gap among them, which fails with ErrIncompatible. Options set directly on
+// the Env are lost.
+func (d *DB) Compact(ctx context.Context) error {
+	d.compactMu.Lock()
+	defer d.compactMu.Unlock()
+
+	env := d.env
+	data := d.dataFile()
+	dest := data + compactSuffix
+	os.Remove(dest)
+	os.Remove(dest + "-lck")
+
+	log := &compactLog{txns: map[uint64]*compactTxn{}}
+	env.capture.Store(log)
+	defer env.capture.Store(nil)
+
+	if err := copyCompact(env, dest); err != ErrSuccess {
+		return err
+	}
+	if compactCopied != nil {
+		compactCopied()
+	}
+	cp, next, err := d.openCopy(dest)
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	discard := func() {
+		if cp != nil {
+			cp.Close(true)
+		}
+		os.Remove(dest)
+		os.Remove(dest + "-lck")
+	}
+
+	// catch up without blocking, then again once transactions are stopped
+	var dbis []namedDBI
+	replayable := true
+	catchUp := func(final bool) error {
+		if dbis, err = env.namedDBIs(); err != nil {
+			return err
+		}
+		txns, last, complete := log.take(next)
+		if final && complete {
+			// a transaction begun before the recording has no entry
+			var id uint64
+			if e := env.rawTxn(TxReadOnly, func(tx *Tx) Error {
+				id = tx.ID()
+				return ErrSuccess
+			}); e != ErrSuccess {
+				return e
+			}
+			complete = last > id
+		}
+		if !complete {
+			replayable = false
+			return nil
+		}
+		var restore Error
+		e := cp.rawTxn(TxReadWrite, func(tx *Tx) Error {
+			if restore = openDBIs(tx, dbis, true); restore != ErrSuccess {
+				return restore
+			}
+			return replay(tx, txns)
+		})
+		if restore != ErrSuccess {
+			return fmt.Errorf("compact: DBI handles can not be restored: %w", restore)
+		}
+		if e != ErrSuccess {
+			replayable = false
+			return nil
+		}
+		next = last
+		return nil
+	}
+	if err = catchUp(false); err != nil {
+		discard()
+		return err
+	}
+
+	if err = env.closeGate(ctx); err != nil {
+		discard()
+		return err
+	}
+	defer env.openGate()
+	env.dropIdleReaders()
+	if replayable {
+		if err = catchUp(true); err != nil {
+			discard()
+			return err
+		}
+	}
+	if !replayable {
+		// nothing runs now, a copy is up to date
+		discard()
+		if e := copyCompact(env, dest); e != ErrSuccess {
+			return e
+		}
+		if dbis, err = env.namedDBIs(); err != nil {
+			os.Remove(dest)
+			return err
+		}
+		if cp, _, err = d.openCopy(dest); err != nil {
+			os.Remove(dest)
+			return err
+		}
+		e := cp.rawTxn(TxReadWrite, func(tx *Tx) Error {
+			return openDBIs(tx, dbis, true)
+		})
+		if e != ErrSuccess {
+			discard()
+			return fmt.Errorf("compact: DBI handles can not be restored: %w", e)
+		}
+	}
+	if e := cp.Close(false); e != ErrSuccess {
+		cp = nil
+		discard()
+		return e
+	}
+	os.Remove(dest + "-lck")
+	return d.swap(dest, data, dbis)
+}
+
+func copyCompact(env *Env, dest string) Error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return env.Copy(dest, CopyCompact)
+}
+
+// openCopy open the compacted copy, returning the ID of the first
+// transaction it misses.
+func (d *DB) openCopy(path string) (*Env, uint64, error) {
+	cp, err := NewEnv()
+	if err != ErrSuccess {
+		return nil, 0, err
+	}
+	if err = cp.SetMaxDBS(d.opts.MaxDBS); err == ErrSuccess {
+		err = cp.Open(path, (d.opts.Flags|EnvNoSubDir)&^EnvReadOnly, 0664)
+	}
+	if err != ErrSuccess {
+		cp.Close(true)
+		return nil, 0, err
+	}
+	var id uint64
+	err = cp.rawTxn(TxReadOnly, func(tx *Tx) Error {
+		id = tx.ID()
+		return ErrSuccess
+	})
+	if err != ErrSuccess {
+		cp.Close(true)
+		return nil, 0, err
+	}
+	return cp, id + 1, nil
+}
+
+// swap replace the data file with the copy and reopen the environment in
+// place, so the Env and the hooks registered on it are kept.
+func (d *DB) swap(copyPath, data string, dbis []namedDBI) error {
+	env := d.env
+	if err := Error(C.mdbx_env_close_ex(env.env, false)); err != ErrSuccess {
+		os.Remove(copyPath)
+		return err
+	}
+	// reset transactions of the closed environment can no longer be renewed
+	env.epoch++
+	renamed := os.Rename(copyPath, data)
+	if renamed != nil {
+		os.Remove(copyPath)
+	}
+	if err := d.reopen(dbis); err != nil {
+		return errors.Join(renamed, err)
+	}
+	return renamed
+}
+
+func (d *DB) reopen(dbis []namedDBI) error {
+	env := d.env
+	env.env = nil
+	env.opened = 0
+	if err := Error(C.mdbx_env_create((**C.MDBX_env)(unsafe.Pointer(&env.env)))); err != ErrSuccess {
+		return err
+	}
+	if err := env.openWith(d.opts); err != ErrSuccess {
+		return err
+	}
+	if env.userData != 0 {
+		h := env.userData
+		env.userData = 0
+		if err := env.SetUserData(h.Value()); err != ErrSuccess {
+			return err
+		}
+		h.Delete()
+	}
+	if err := env.rawTxn(TxReadWrite, func(tx *Tx) Error {
+		return openDBIs(tx, dbis, false)
+	}); err != ErrSuccess {
+		return fmt.Errorf("compact: DBI handles can not be restored: %w", err)
+	}
+	return nil
+}
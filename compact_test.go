@@ -0,0 +1,288 @@
+package gmdbx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompactDb(t *testing.T) *DB {
+	db, err := New("testmdbx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll("testmdbx")
+	opts := DefaultOption
+	opts.Path = "testmdbx"
+	opts.Geometry = Geometry{
+		SizeLower:       1 << 20,
+		SizeNow:         1 << 20,
+		SizeUpper:       1 << 30,
+		GrowthStep:      1 << 20,
+		ShrinkThreshold: 1 << 30,
+		PageSize:        4096,
+	}
+	db.SetOption(&opts)
+	if err = db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func fillCompactDb(t *testing.T, db *DB, dbi DBI) {
+	value := make([]byte, 200)
+	err := db.update(func(tx *Tx) error {
+		for i := 0; i < 20000; i++ {
+			if e := indexPut(tx, dbi, fmt.Sprintf("k%05d", i), string(value)); e != ErrSuccess {
+				return e
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	err = db.update(func(tx *Tx) error {
+		for i := 0; i < 20000; i++ {
+			if i%10 == 0 {
+				continue
+			}
+			k := bytesVal([]byte(fmt.Sprintf("k%05d", i)))
+			if e := tx.Delete(dbi, &k, nil); e != ErrSuccess {
+				return e
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+// compactWriter put keys through fn until stopped, returning the keys of the
+// committed transactions
+func compactWriter(db *DB, dbi DBI, fn func(tx *Tx, key string) Error) (stop func() []string) {
+	done := make(chan struct{})
+	var written []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := fmt.Sprintf("w%06d", i)
+			err := db.update(func(tx *Tx) error {
+				if e := fn(tx, key); e != ErrSuccess {
+					return e
+				}
+				return nil
+			})
+			if err == nil {
+				written = append(written, key)
+			}
+		}
+	}()
+	return func() []string {
+		close(done)
+		wg.Wait()
+		return written
+	}
+}
+
+func TestCompact(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write func(tx *Tx, dbi DBI, key string) Error
+	}{
+		{"replayed", func(tx *Tx, dbi DBI, key string) Error {
+			return indexPut(tx, dbi, key, "v")
+		}},
+		{"canary replayed", func(tx *Tx, dbi DBI, key string) Error {
+			if e := indexPut(tx, dbi, key, "v"); e != ErrSuccess {
+				return e
+			}
+			if key != "w000000" {
+				return ErrSuccess
+			}
+			// only written during the copy
+			return tx.PutCanary(&Canary{X: 1, Z: 7})
+		}},
+		{"copied again", func(tx *Tx, dbi DBI, key string) Error {
+			cur, err := tx.OpenCursor(dbi)
+			if err != ErrSuccess {
+				return err
+			}
+			defer cur.Close()
+			k, v := bytesVal([]byte(key)), bytesVal([]byte("v"))
+			return cur.Put(&k, &v, PutUpsert)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newCompactDb(t)
+			defer db.Close()
+			other := openLoaderDBI(t, db, "other", DBCreate|DBDupSort)
+			dbi := openLoaderDBI(t, db, "compact", DBCreate)
+			fillCompactDb(t, db, dbi)
+			assert.NoError(t, db.update(func(tx *Tx) error {
+				indexPut(tx, other, "a", "1")
+				indexPut(tx, other, "a", "2")
+				return nil
+			}))
+			keys, values := loaderContents(t, db, dbi)
+			before := fileSize(t, db.dataFile())
+
+			write := func(tx *Tx, key string) Error { return tc.write(tx, dbi, key) }
+			var stop func() []string
+			compactCopied = func() {
+				stop = compactWriter(db, dbi, write)
+				time.Sleep(5 * time.Millisecond)
+			}
+			defer func() { compactCopied = nil }()
+			err := db.Compact(context.Background())
+			written := stop()
+			assert.NotEmpty(t, written)
+			assert.NoError(t, err)
+			assert.Less(t, fileSize(t, db.dataFile()), before)
+			assert.NoFileExists(t, db.dataFile()+compactSuffix)
+
+			// the handles are still valid
+			gotKeys, gotValues := loaderContents(t, db, dbi)
+			assert.Equal(t, len(keys)+len(written), len(gotKeys))
+			assert.Equal(t, keys, gotKeys[:len(keys)])
+			assert.Equal(t, values, gotValues[:len(keys)])
+			for i, k := range written {
+				assert.Equal(t, k, string(gotKeys[len(keys)+i]))
+			}
+			var c Canary
+			assert.NoError(t, db.update(func(tx *Tx) error {
+				if e := tx.GetCanary(&c); e != ErrSuccess {
+					return e
+				}
+				return nil
+			}))
+			if tc.name == "canary replayed" {
+				assert.Equal(t, []uint64{1, 7}, []uint64{c.X, c.Z})
+			}
+			otherKeys, otherValues := loaderContents(t, db, other)
+			assert.Equal(t, [][]byte{[]byte("a"), []byte("a")}, otherKeys)
+			assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, otherValues)
+			assert.NoError(t, db.update(func(tx *Tx) error {
+				if e := indexPut(tx, dbi, "after", "v"); e != ErrSuccess {
+					return e
+				}
+				return nil
+			}))
+		})
+	}
+}
+
+func TestCompactWaitsForTransactions(t *testing.T) {
+	db := newCompactDb(t)
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "compact", DBCreate)
+	fillCompactDb(t, db, dbi)
+
+	started, release, ended := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tx := NewTransaction(db.env)
+		db.env.Begin(tx, TxReadOnly)
+		close(started)
+		<-release
+		tx.Abort()
+		close(ended)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, db.Compact(ctx), context.DeadlineExceeded)
+	assert.NoFileExists(t, db.dataFile()+compactSuffix)
+	close(release)
+	<-ended
+
+	// transactions go on and the next compaction succeeds
+	assert.NoError(t, db.update(func(tx *Tx) error {
+		if e := indexPut(tx, dbi, "after", "v"); e != ErrSuccess {
+			return e
+		}
+		return nil
+	}))
+	assert.NoError(t, db.Compact(context.Background()))
+	keys, _ := loaderContents(t, db, dbi)
+	assert.Len(t, keys, 2001)
+}
+
+func TestCompactIdleReaders(t *testing.T) {
+	db := newCompactDb(t)
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "compact", DBCreate)
+	fillCompactDb(t, db, dbi)
+
+	pool := db.NewReadPool(0)
+	defer pool.Close()
+	assert.NoError(t, pool.View(func(tx *Tx) error { return nil }))
+	assert.Equal(t, 1, pool.Stats().Idle)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	reset := NewTransaction(db.env)
+	if e := db.env.Begin(reset, TxReadOnly); e != ErrSuccess {
+		t.Fatal(e)
+	}
+	assert.Equal(t, ErrSuccess, reset.Reset())
+
+	// neither the pool nor the reset transaction hold back the compaction
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, db.Compact(ctx))
+	assert.Zero(t, pool.Stats().Idle)
+	assert.Equal(t, ErrBadTXN, reset.Renew())
+	reset.Abort()
+
+	assert.NoError(t, pool.View(func(tx *Tx) error {
+		var st Stats
+		if e := tx.DBIStat(dbi, &st); e != ErrSuccess {
+			return e
+		}
+		assert.Equal(t, uint64(2000), st.Entries)
+		return nil
+	}))
+}
+
+func TestShrink(t *testing.T) {
+	db := newCompactDb(t)
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "shrink", DBCreate)
+	fillCompactDb(t, db, dbi)
+	assert.NoError(t, db.update(func(tx *Tx) error {
+		if e := tx.Drop(dbi, false); e != ErrSuccess {
+			return e
+		}
+		return nil
+	}))
+
+	var before EnvInfo
+	assert.Equal(t, ErrSuccess, db.env.envInfo(&before))
+	reclaimed, err := db.env.Shrink()
+	assert.Equal(t, ErrSuccess, err)
+	var after EnvInfo
+	assert.Equal(t, ErrSuccess, db.env.envInfo(&after))
+	assert.Equal(t, before.Geo.Current-reclaimed, after.Geo.Current)
+	assert.GreaterOrEqual(t, after.Geo.Current, (after.LastPageNumber+1)*uint64(after.DXBPageSize))
+}
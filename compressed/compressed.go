@@ -0,0 +1,260 @@
+// Package compressed stores values of a gmdbx table compressed.
+//
+// Every stored value starts with a header byte, 0 for a value stored as is,
+// otherwise the ID of the Compressor which compressed it. IDs below 16 are
+// reserved for the compressors of this package, other ones must use IDs from
+// 16 to 255. Values shorter than
+// Options.MinSize, or which do not shrink, are stored raw, so raw and
+// compressed values coexist and the compressor of a bucket can be changed
+// while older values stay readable.
+//
+// A bucket may compress with a dictionary of typical content, which helps
+// small values a lot. The dictionary is kept in the table under DictKey, the
+// first time the bucket is opened with one, and is used from then on.
+//
+// Tables with DBDupSort are not supported.
+package compressed
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sunvim/gmdbx"
+)
+
+// DictKey reserved key of the dictionary of a table
+const DictKey = "\x00gmdbx.compressed.dict"
+
+var (
+	ErrReservedKey  = errors.New("compressed: reserved key")
+	ErrCompressor   = errors.New("compressed: unknown compressor")
+	ErrDictionary   = errors.New("compressed: table has another dictionary")
+	ErrDupSort      = errors.New("compressed: DBDupSort tables are not supported")
+	ErrCompressorID = errors.New("compressed: invalid compressor ID")
+)
+
+// Options configuration of a Bucket
+type Options struct {
+	// Compressor compresses the values written, default NewFlate with
+	// flate.DefaultCompression.
+	Compressor Compressor
+	// Decompressors other compressors values may have been written with, the
+	// ones of this package are always known.
+	Decompressors []Compressor
+	// MinSize values shorter are stored raw, default 64
+	MinSize int
+	// Dictionary stored with the table if it has none yet. compress/flate
+	// only makes use of it for small values at flate.BestCompression.
+	Dictionary []byte
+}
+
+// Bucket compressed view of a named table. Like gmdbx.Store it holds no
+// transaction and may be shared by goroutines. Returned slices are copies.
+type Bucket struct {
+	dbi     gmdbx.DBI
+	opts    Options
+	dict    []byte
+	readers map[byte]Compressor
+}
+
+// New open, or create with DBCreate in flags, the table name inside tx, and
+// load or store its dictionary. It fails with ErrCompressorID if a compressor
+// of opts has the ID 0, a reserved ID, or the ID of another one.
+func New(tx *gmdbx.Tx, name string, flags gmdbx.DBFlags, opts Options) (*Bucket, error) {
+	if flags&gmdbx.DBDupSort != 0 {
+		return nil, ErrDupSort
+	}
+	if opts.Compressor == nil {
+		opts.Compressor = NewFlate(flate.DefaultCompression)
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 64
+	}
+	readers, err := compressors(opts)
+	if err != nil {
+		return nil, err
+	}
+	dbi, e := tx.OpenDBI(name, flags)
+	if e != gmdbx.ErrSuccess {
+		return nil, e
+	}
+	b := &Bucket{dbi: dbi, opts: opts, readers: readers}
+
+	key, v := []byte(DictKey), gmdbx.Val{}
+	k := val(key)
+	switch e = tx.Get(dbi, &k, &v); e {
+	case gmdbx.ErrSuccess:
+		b.dict = v.Bytes()
+		if opts.Dictionary != nil && !bytes.Equal(opts.Dictionary, b.dict) {
+			return nil, fmt.Errorf("%w: %s", ErrDictionary, name)
+		}
+	case gmdbx.ErrNotFound:
+		if opts.Dictionary == nil {
+			break
+		}
+		b.dict = append([]byte(nil), opts.Dictionary...)
+		v = val(b.dict)
+		if e = tx.Put(dbi, &k, &v, gmdbx.PutUpsert); e != gmdbx.ErrSuccess {
+			return nil, e
+		}
+	default:
+		return nil, e
+	}
+	return b, nil
+}
+
+// compressors index the compressors of opts and of this package by ID
+func compressors(opts Options) (map[byte]Compressor, error) {
+	readers := map[byte]Compressor{
+		flateID: NewFlate(flate.DefaultCompression),
+		zlibID:  NewZlib(flate.DefaultCompression),
+	}
+	seen := map[byte]bool{}
+	for _, c := range append([]Compressor{opts.Compressor}, opts.Decompressors...) {
+		id := c.ID()
+		if id == rawID {
+			return nil, fmt.Errorf("%w: 0 marks raw values", ErrCompressorID)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: %d used twice", ErrCompressorID, id)
+		}
+		if _, builtin := c.(*stream); id < firstUserID && !builtin {
+			return nil, fmt.Errorf("%w: %d is reserved", ErrCompressorID, id)
+		}
+		seen[id] = true
+		readers[id] = c
+	}
+	return readers, nil
+}
+
+// Open open the table name of the database, creating it if needed
+func Open(db *gmdbx.DB, name string, opts Options) (*Bucket, error) {
+	var b *Bucket
+	err := db.UpdateContext(context.Background(), func(tx *gmdbx.Tx) (err error) {
+		b, err = New(tx, name, gmdbx.DBCreate, opts)
+		return err
+	})
+	return b, err
+}
+
+// DBI return the handle of the table
+func (b *Bucket) DBI() gmdbx.DBI {
+	return b.dbi
+}
+
+// Dictionary return the dictionary of the table, nil without one
+func (b *Bucket) Dictionary() []byte {
+	return b.dict
+}
+
+// Encode return value as stored, with its header
+func (b *Bucket) Encode(value []byte) ([]byte, error) {
+	if len(value) >= b.opts.MinSize {
+		c := b.opts.Compressor
+		out, err := c.Compress([]byte{c.ID()}, value, b.dict)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) < len(value)+1 {
+			return out, nil
+		}
+	}
+	return append([]byte{rawID}, value...), nil
+}
+
+// Decode return a copy of the value of a stored one, as read with a cursor
+func (b *Bucket) Decode(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty value", ErrCompressor)
+	}
+	if data[0] == rawID {
+		return append([]byte{}, data[1:]...), nil
+	}
+	c, ok := b.readers[data[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrCompressor, data[0])
+	}
+	return c.Decompress(nil, data[1:], b.dict)
+}
+
+func reserved(key []byte) bool {
+	return string(key) == DictKey
+}
+
+// Get return the value of key, false if key does not exist
+func (b *Bucket) Get(tx *gmdbx.Tx, key []byte) ([]byte, bool, error) {
+	if reserved(key) {
+		return nil, false, ErrReservedKey
+	}
+	k, v := val(key), gmdbx.Val{}
+	switch e := tx.Get(b.dbi, &k, &v); e {
+	case gmdbx.ErrSuccess:
+	case gmdbx.ErrNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, e
+	}
+	value, err := b.Decode(v.UnsafeBytes())
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Put set the value of key, compressed if it is worth it
+func (b *Bucket) Put(tx *gmdbx.Tx, key, value []byte) error {
+	if reserved(key) {
+		return ErrReservedKey
+	}
+	data, err := b.Encode(value)
+	if err != nil {
+		return err
+	}
+	k, v := val(key), val(data)
+	if e := tx.Put(b.dbi, &k, &v, gmdbx.PutUpsert); e != gmdbx.ErrSuccess {
+		return e
+	}
+	return nil
+}
+
+// Delete remove key, false if it did not exist
+func (b *Bucket) Delete(tx *gmdbx.Tx, key []byte) (bool, error) {
+	if reserved(key) {
+		return false, ErrReservedKey
+	}
+	k := val(key)
+	switch e := tx.Delete(b.dbi, &k, nil); e {
+	case gmdbx.ErrSuccess:
+		return true, nil
+	case gmdbx.ErrNotFound:
+		return false, nil
+	default:
+		return false, e
+	}
+}
+
+// ForEach call fn with every pair in key order, the dictionary excepted. The
+// key is only valid until fn returns.
+func (b *Bucket) ForEach(tx *gmdbx.Tx, fn func(key, value []byte) error) error {
+	return tx.ForEach(b.dbi, func(k, v []byte) error {
+		if reserved(k) {
+			return nil
+		}
+		value, err := b.Decode(v)
+		if err != nil {
+			return err
+		}
+		return fn(k, value)
+	})
+}
+
+// val like gmdbx.Bytes, but an empty slice, a valid key, gives an empty Val
+func val(b []byte) gmdbx.Val {
+	if len(b) == 0 {
+		return gmdbx.Val{}
+	}
+	return gmdbx.Bytes(&b)
+}
@@ -0,0 +1,239 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sunvim/gmdbx"
+)
+
+func openDB(t *testing.T) *gmdbx.DB {
+	db, err := gmdbx.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func update(t *testing.T, db *gmdbx.DB, fn func(tx *gmdbx.Tx) error) {
+	assert.NoError(t, db.UpdateContext(context.Background(), fn))
+}
+
+func view(t *testing.T, db *gmdbx.DB, fn func(tx *gmdbx.Tx) error) {
+	assert.NoError(t, db.ViewContext(context.Background(), fn))
+}
+
+// raw return the stored value of key
+func raw(t *testing.T, db *gmdbx.DB, dbi gmdbx.DBI, key string) []byte {
+	var out []byte
+	view(t, db, func(tx *gmdbx.Tx) error {
+		kb := []byte(key)
+		k, v := gmdbx.Bytes(&kb), gmdbx.Val{}
+		if e := tx.Get(dbi, &k, &v); e != gmdbx.ErrSuccess {
+			return e
+		}
+		out = v.Bytes()
+		return nil
+	})
+	return out
+}
+
+func jsonValue(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user %d","email":"user%d@example.com","tags":["a","b","c"],"active":true}`, i, i, i))
+}
+
+// custom application Compressor
+type custom struct {
+	Compressor
+}
+
+func (custom) ID() byte { return 200 }
+
+func TestBucket(t *testing.T) {
+	big := bytes.Repeat([]byte(`{"k":"v"},`), 100)
+	for _, tc := range []struct {
+		name string
+		opts Options
+		id   byte
+	}{
+		{"flate", Options{}, flateID},
+		{"zlib", Options{Compressor: NewZlib(flate.BestCompression)}, zlibID},
+		{"dictionary", Options{Compressor: NewFlate(flate.BestCompression), Dictionary: jsonValue(0)}, flateID},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openDB(t)
+			b, err := Open(db, "docs", tc.opts)
+			assert.NoError(t, err)
+
+			update(t, db, func(tx *gmdbx.Tx) error {
+				assert.NoError(t, b.Put(tx, []byte("big"), big))
+				assert.NoError(t, b.Put(tx, []byte("small"), []byte("tiny")))
+				assert.NoError(t, b.Put(tx, []byte("empty"), nil))
+				assert.ErrorIs(t, b.Put(tx, []byte(DictKey), nil), ErrReservedKey)
+				return nil
+			})
+
+			stored := raw(t, db, b.DBI(), "big")
+			assert.Equal(t, tc.id, stored[0])
+			assert.Less(t, len(stored), len(big)/5)
+			assert.Equal(t, append([]byte{rawID}, "tiny"...), raw(t, db, b.DBI(), "small"))
+
+			view(t, db, func(tx *gmdbx.Tx) error {
+				v, ok, err := b.Get(tx, []byte("big"))
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, big, v)
+				_, ok, err = b.Get(tx, []byte("missing"))
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				var keys []string
+				assert.NoError(t, b.ForEach(tx, func(k, v []byte) error {
+					keys = append(keys, string(k))
+					return nil
+				}))
+				assert.Equal(t, []string{"big", "empty", "small"}, keys)
+				return nil
+			})
+		})
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	db := openDB(t)
+	dict := jsonValue(0)
+	best := NewFlate(flate.BestCompression)
+	plain, err := Open(db, "plain", Options{Compressor: best, MinSize: 1})
+	assert.NoError(t, err)
+	b, err := Open(db, "docs", Options{Compressor: best, MinSize: 1, Dictionary: dict})
+	assert.NoError(t, err)
+	assert.Equal(t, dict, b.Dictionary())
+	update(t, db, func(tx *gmdbx.Tx) error {
+		assert.NoError(t, plain.Put(tx, []byte("k"), jsonValue(1)))
+		assert.NoError(t, b.Put(tx, []byte("k"), jsonValue(1)))
+		return nil
+	})
+	// small values shrink far more with the dictionary
+	assert.Less(t, 2*len(raw(t, db, b.DBI(), "k")), len(raw(t, db, plain.DBI(), "k")))
+
+	// the stored dictionary is loaded, another one is refused
+	b, err = Open(db, "docs", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, dict, b.Dictionary())
+	view(t, db, func(tx *gmdbx.Tx) error {
+		v, _, err := b.Get(tx, []byte("k"))
+		assert.NoError(t, err)
+		assert.Equal(t, jsonValue(1), v)
+		return nil
+	})
+	_, err = Open(db, "docs", Options{Dictionary: []byte("other")})
+	assert.ErrorIs(t, err, ErrDictionary)
+}
+
+func TestCompressorChange(t *testing.T) {
+	db := openDB(t)
+	zb, err := Open(db, "docs", Options{Compressor: NewZlib(flate.DefaultCompression)})
+	assert.NoError(t, err)
+	value := []byte(strings.Repeat("abc", 100))
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return zb.Put(tx, []byte("old"), value)
+	})
+
+	// values of the previous compressor stay readable
+	fb, err := Open(db, "docs", Options{})
+	assert.NoError(t, err)
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return fb.Put(tx, []byte("new"), value)
+	})
+	view(t, db, func(tx *gmdbx.Tx) error {
+		for _, k := range []string{"old", "new"} {
+			v, _, err := fb.Get(tx, []byte(k))
+			assert.NoError(t, err)
+			assert.Equal(t, value, v)
+		}
+		return nil
+	})
+
+	// values of an application compressor need it as a decompressor
+	c := custom{NewFlate(flate.DefaultCompression)}
+	cb, err := Open(db, "docs", Options{Compressor: c})
+	assert.NoError(t, err)
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return cb.Put(tx, []byte("custom"), value)
+	})
+	assert.Equal(t, byte(200), raw(t, db, cb.DBI(), "custom")[0])
+	view(t, db, func(tx *gmdbx.Tx) error {
+		_, _, err := fb.Get(tx, []byte("custom"))
+		assert.ErrorIs(t, err, ErrCompressor)
+		return nil
+	})
+	fb, err = Open(db, "docs", Options{Decompressors: []Compressor{c}})
+	assert.NoError(t, err)
+	view(t, db, func(tx *gmdbx.Tx) error {
+		v, _, err := fb.Get(tx, []byte("custom"))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+		return nil
+	})
+}
+
+type withID struct {
+	Compressor
+	id byte
+}
+
+func (c withID) ID() byte { return c.id }
+
+func TestCompressorID(t *testing.T) {
+	db := openDB(t)
+	flt := NewFlate(flate.DefaultCompression)
+	for _, opts := range []Options{
+		{Compressor: withID{flt, rawID}},
+		{Decompressors: []Compressor{withID{flt, 0}}},
+		{Compressor: withID{flt, flateID}},
+		{Compressor: withID{flt, zlibID}},
+		{Compressor: withID{flt, 15}},
+		{Compressor: withID{flt, 200}, Decompressors: []Compressor{custom{flt}}},
+		{Decompressors: []Compressor{withID{flt, 16}, withID{flt, 16}}},
+	} {
+		_, err := Open(db, "docs", opts)
+		assert.ErrorIs(t, err, ErrCompressorID, "%+v", opts)
+	}
+
+	_, err := Open(db, "docs", Options{Compressor: withID{flt, 16}, Decompressors: []Compressor{custom{flt}}})
+	assert.NoError(t, err)
+}
+
+func TestEmptyKey(t *testing.T) {
+	db := openDB(t)
+	b, err := Open(db, "docs", Options{})
+	assert.NoError(t, err)
+	value := []byte(strings.Repeat("abc", 100))
+	update(t, db, func(tx *gmdbx.Tx) error {
+		assert.NoError(t, b.Put(tx, []byte{}, value))
+		return nil
+	})
+	view(t, db, func(tx *gmdbx.Tx) error {
+		v, ok, err := b.Get(tx, nil)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, value, v)
+		return nil
+	})
+	update(t, db, func(tx *gmdbx.Tx) error {
+		ok, err := b.Delete(tx, []byte{})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		return nil
+	})
+}
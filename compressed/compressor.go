@@ -0,0 +1,117 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// Compressor compresses the values of a Bucket
+type Compressor interface {
+	// ID header byte of the values it compresses, not 0 which marks raw
+	// values. IDs below 16 are reserved for the compressors of this package.
+	ID() byte
+	// Compress append the compression of src with the dictionary dict, nil
+	// without one, to dst.
+	Compress(dst, src, dict []byte) ([]byte, error)
+	// Decompress append the decompression of src to dst
+	Decompress(dst, src, dict []byte) ([]byte, error)
+}
+
+const (
+	rawID   = 0
+	flateID = 1
+	zlibID  = 2
+
+	// firstUserID lowest ID of the compressors of other packages
+	firstUserID = 16
+)
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// stream Compressor over a compress/* writer and reader, writers without a
+// dictionary are reused.
+type stream struct {
+	id        byte
+	level     int
+	newWriter func(w io.Writer, level int, dict []byte) (resetWriter, error)
+	newReader func(r io.Reader, dict []byte) (io.ReadCloser, error)
+	writers   sync.Pool
+}
+
+// NewFlate return a Compressor using raw DEFLATE at level, see compress/flate
+func NewFlate(level int) Compressor {
+	return &stream{
+		id:    flateID,
+		level: level,
+		newWriter: func(w io.Writer, level int, dict []byte) (resetWriter, error) {
+			return flate.NewWriterDict(w, level, dict)
+		},
+		newReader: func(r io.Reader, dict []byte) (io.ReadCloser, error) {
+			return flate.NewReaderDict(r, dict), nil
+		},
+	}
+}
+
+// NewZlib return a Compressor using zlib at level, see compress/zlib
+func NewZlib(level int) Compressor {
+	return &stream{
+		id:    zlibID,
+		level: level,
+		newWriter: func(w io.Writer, level int, dict []byte) (resetWriter, error) {
+			return zlib.NewWriterLevelDict(w, level, dict)
+		},
+		newReader: zlib.NewReaderDict,
+	}
+}
+
+func (s *stream) ID() byte {
+	return s.id
+}
+
+func (s *stream) Compress(dst, src, dict []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	var (
+		w   resetWriter
+		err error
+	)
+	if dict == nil {
+		if x, ok := s.writers.Get().(resetWriter); ok {
+			w = x
+			w.Reset(buf)
+		}
+	}
+	if w == nil {
+		if w, err = s.newWriter(buf, s.level, dict); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = w.Write(src); err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dict == nil {
+		s.writers.Put(w)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *stream) Decompress(dst, src, dict []byte) ([]byte, error) {
+	r, err := s.newReader(bytes.NewReader(src), dict)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := bytes.NewBuffer(dst)
+	if _, err = buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,182 @@
+package gmdbx
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// ContextCheckInterval number of keys visited by iterators between checks of
+// the context.
+var ContextCheckInterval = 256
+
+const (
+	minBusyBackoff = 50 * time.Microsecond
+	maxBusyBackoff = 10 * time.Millisecond
+)
+
+// Context return the context the transaction was started with by
+// UpdateContext or ViewContext, context.Background() otherwise.
+func (tx *Tx) Context() context.Context {
+	if tx.ctx == nil {
+		return context.Background()
+	}
+	return tx.ctx
+}
+
+// checkContext break the transaction if ctx is done, so any further
+// operation fails and it can only be aborted.
+func (tx *Tx) checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		tx.Break()
+		return err
+	}
+	return nil
+}
+
+// breakOnDone break the transaction once ctx is done, even while the caller
+// is blocked outside of it. The returned stop must be called before the
+// transaction ends, it waits for a Break already running.
+func (tx *Tx) breakOnDone(ctx context.Context) (stop func()) {
+	broken := make(chan struct{})
+	stopFunc := context.AfterFunc(ctx, func() {
+		tx.Break()
+		close(broken)
+	})
+	return func() {
+		if !stopFunc() {
+			<-broken
+		}
+	}
+}
+
+// beginContext start a transaction, a write transaction is started with
+// TxTry and retried until the writer lock is free or ctx is done.
+func (d *DB) beginContext(ctx context.Context, txn *Tx, flags TxFlags) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if flags&TxReadOnly != 0 {
+		if err := d.env.Begin(txn, flags); err != ErrSuccess {
+			return err
+		}
+		txn.ctx = ctx
+		return nil
+	}
+
+	var timer *time.Timer
+	backoff := minBusyBackoff
+	for {
+		err := d.env.Begin(txn, flags|TxTry)
+		if err == ErrSuccess {
+			txn.ctx = ctx
+			return nil
+		}
+		if err != ErrBusy {
+			return err
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxBusyBackoff {
+			backoff = maxBusyBackoff
+		}
+	}
+}
+
+// UpdateContext run fn in a write transaction like Update, waiting for the
+// writer lock is given up when ctx is done. Once ctx is done the transaction
+// is broken, so any further operation of fn fails. The transaction is
+// committed only if fn succeeds and ctx is still alive, otherwise it is
+// aborted.
+func (d *DB) UpdateContext(ctx context.Context, fn func(tx *Tx) error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	txn := NewTransaction(d.env)
+	if err := d.beginContext(ctx, txn, TxReadWrite); err != nil {
+		return err
+	}
+	stop := txn.breakOnDone(ctx)
+	err := fn(txn)
+	stop()
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		txn.Abort()
+		return err
+	}
+	if err := txn.Commit(); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+// ViewContext run fn in a read-only transaction like View, the transaction is
+// broken once ctx is done so iterators and any further read of fn fail.
+func (d *DB) ViewContext(ctx context.Context, fn func(tx *Tx) error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	txn := NewTransaction(d.env)
+	if err := d.beginContext(ctx, txn, TxReadOnly); err != nil {
+		return err
+	}
+	defer txn.Abort()
+	defer txn.breakOnDone(ctx)()
+
+	return fn(txn)
+}
+
+// ForEach call fn for every key/value pair of dbi in order, the slices are
+// only valid until fn returns. Iteration stops at the first error, and when
+// the context of the transaction is done.
+func (tx *Tx) ForEach(dbi DBI, fn func(k, v []byte) error) error {
+	return tx.ForEachContext(tx.Context(), dbi, fn)
+}
+
+// ForEachContext like ForEach, ctx is checked every ContextCheckInterval keys
+// and the transaction is broken once it is done.
+func (tx *Tx) ForEachContext(ctx context.Context, dbi DBI, fn func(k, v []byte) error) error {
+	cur, err := tx.OpenCursor(dbi)
+	if err != ErrSuccess {
+		return err
+	}
+	defer cur.Close()
+
+	var k, v Val
+	op := CursorFirst
+	for i := 0; ; i++ {
+		if i%ContextCheckInterval == 0 {
+			if err := tx.checkContext(ctx); err != nil {
+				return err
+			}
+		}
+		err := cur.Get(&k, &v, op)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != ErrSuccess {
+			// broken by UpdateContext or ViewContext
+			if cerr := ctx.Err(); cerr != nil {
+				return cerr
+			}
+			return err
+		}
+		if err := fn(k.UnsafeBytes(), v.UnsafeBytes()); err != nil {
+			return err
+		}
+		op = CursorNext
+	}
+}
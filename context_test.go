@@ -0,0 +1,131 @@
+package gmdbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateContextBusy(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	// hold the writer lock from another thread
+	w := db.NewWriter(WriterOptions{})
+	started, release := make(chan struct{}), make(chan struct{})
+	held := w.Submit(func(tx *Tx) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = db.UpdateContext(ctx, func(tx *Tx) error {
+		t.Fatal("writer lock should not be acquired")
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.NoError(t, held.Wait())
+
+	err = db.UpdateContext(context.Background(), func(tx *Tx) error {
+		dbi, e := tx.OpenDBI("context", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		for i := 0; i < 1000; i++ {
+			k := ToVal(uint64(i))
+			if e = tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+				return e
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestForEachContext(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var dbi DBI
+	err = db.UpdateContext(context.Background(), func(tx *Tx) error {
+		var e Error
+		if dbi, e = tx.OpenDBI("context", DBCreate); e != ErrSuccess {
+			return e
+		}
+		for i := 0; i < 1000; i++ {
+			k := ToVal(uint64(i))
+			if e = tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = db.ViewContext(context.Background(), func(tx *Tx) error {
+		return tx.ForEach(dbi, func(k, v []byte) error {
+			n++
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = db.ViewContext(ctx, func(tx *Tx) error {
+		return tx.ForEach(dbi, func(k, v []byte) error {
+			if n++; n == 10 {
+				cancel()
+			}
+			return nil
+		})
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.LessOrEqual(t, n, ContextCheckInterval)
+
+	// a read blocked outside of the transaction is broken as soon as ctx is done
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = db.ViewContext(ctx, func(tx *Tx) error {
+		<-ctx.Done()
+		time.Sleep(time.Millisecond)
+		k, v := ToVal(uint64(1)), Val{}
+		return tx.Get(dbi, &k, &v)
+	})
+	assert.Equal(t, ErrBadTXN, err)
+
+	// a canceled update is aborted
+	ctx, cancel = context.WithCancel(context.Background())
+	err = db.UpdateContext(ctx, func(tx *Tx) error {
+		k := ToVal(uint64(5000))
+		if e := tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+			return e
+		}
+		cancel()
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	err = db.View(func(tx *Tx) error {
+		k, v := ToVal(uint64(5000)), Val{}
+		assert.Equal(t, ErrNotFound, tx.Get(dbi, &k, &v))
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,20 @@
+//go:build gmdbx_debug
+
+package gmdbx
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+// trackCursorStacks record where each cursor was opened, so cursors left open
+// when their transaction ends can be reported.
+const trackCursorStacks = true
+
+func cursorStack() []byte {
+	return debug.Stack()
+}
+
+func reportLeakedCursor(tx *Tx, stack []byte) {
+	log.Printf("gmdbx: cursor not closed before end of txn %d, opened at:\n%s", tx.ID(), stack)
+}
@@ -0,0 +1,38 @@
+//go:build gmdbx_debug
+
+package gmdbx
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorLeakReport(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	var cur *Cursor
+	err = db.Update(func(tx *Tx) error {
+		dbi, e := tx.OpenDBI("cursors", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		cur, _ = tx.OpenCursor(dbi)
+		return nil
+	})
+	assert.NoError(t, err)
+	cur.Close()
+	assert.Contains(t, buf.String(), "cursor not closed")
+	assert.Contains(t, buf.String(), "TestCursorLeakReport")
+}
@@ -0,0 +1,11 @@
+//go:build !gmdbx_debug
+
+package gmdbx
+
+const trackCursorStacks = false
+
+func cursorStack() []byte {
+	return nil
+}
+
+func reportLeakedCursor(tx *Tx, stack []byte) {}
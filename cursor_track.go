@@ -0,0 +1,159 @@
+package gmdbx
+
+//#include "mdbxgo.h"
+import "C"
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/sunvim/gmdbx/unsafecgo"
+)
+
+// Cursors opened by Tx.OpenCursor are registered with their transaction,
+// which reports the ones still open when it ends. Like with libmdbx they stay
+// valid for Cursor.Renew and Cursor.Close, which the caller still has to
+// call. Cursor is a bare C handle, so each of them gets a cursor_ctx as
+// userctx which Close marks closed instead of freeing it. The transaction
+// keeps the cursor_ctx of its cursors and frees the closed ones when it ends,
+// the others go with their cursor and are freed by its Close.
+
+// trackCursor register the cursor_ctx of a cursor opened by the transaction,
+// the closed ones are dropped when the list is full so a long transaction
+// opening and closing cursors does not grow it.
+func (tx *Tx) trackCursor(ctx *C.cursor_ctx) {
+	if len(tx.cursors) > 0 && len(tx.cursors) == cap(tx.cursors) {
+		tx.dropClosedCursors()
+	}
+	tx.cursors = append(tx.cursors, ctx)
+	if trackCursorStacks {
+		tx.cursorStacks = append(tx.cursorStacks, cursorStack())
+	}
+}
+
+func (tx *Tx) dropClosedCursors() {
+	kept := 0
+	for i, ctx := range tx.cursors {
+		if ctx.closed != 0 {
+			tx.captureCursor(ctx)
+			untrackCursor(ctx)
+			continue
+		}
+		tx.cursors[kept] = ctx
+		if trackCursorStacks {
+			tx.cursorStacks[kept] = tx.cursorStacks[i]
+		}
+		kept++
+	}
+	clear(tx.cursors[kept:])
+	tx.cursors = tx.cursors[:kept]
+	if trackCursorStacks {
+		clear(tx.cursorStacks[kept:])
+		tx.cursorStacks = tx.cursorStacks[:kept]
+	}
+}
+
+// untrackCursor free ctx if its cursor is closed, otherwise leave it to the
+// cursor
+func untrackCursor(ctx *C.cursor_ctx) {
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_untrack), uintptr(unsafe.Pointer(ctx)), 0)
+}
+
+// untrackCursors forget the cursors opened by the transaction, in a debug
+// build each one still open is reported as leaked.
+func (tx *Tx) untrackCursors() {
+	if len(tx.cursors) == 0 {
+		return
+	}
+	for i, ctx := range tx.cursors {
+		if ctx.closed == 0 {
+			var stack []byte
+			if trackCursorStacks {
+				stack = tx.cursorStacks[i]
+			}
+			reportLeakedCursor(tx, stack)
+		}
+		tx.captureCursor(ctx)
+		untrackCursor(ctx)
+	}
+	clear(tx.cursors)
+	tx.cursors = tx.cursors[:0]
+	clear(tx.cursorStacks)
+	tx.cursorStacks = tx.cursorStacks[:0]
+}
+
+// OpenCursors return the number of cursors opened by the transaction which are
+// not closed yet.
+func (tx *Tx) OpenCursors() int {
+	n := 0
+	for _, ctx := range tx.cursors {
+		if ctx.closed == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// CursorPool reuses cursors across transactions, saving the malloc and free
+// done by Tx.OpenCursor and Cursor.Close on hot paths. Pooled cursors are
+// created unbound by NewCursor and bound with Tx.Bind, they are not tracked
+// by the transaction and must be given back by Put.
+type CursorPool struct {
+	mu      sync.Mutex
+	free    []*Cursor
+	maxIdle int
+	closed  bool
+}
+
+// NewCursorPool create a cursor pool keeping at most maxIdle unused cursors
+func NewCursorPool(maxIdle int) *CursorPool {
+	return &CursorPool{maxIdle: maxIdle}
+}
+
+// Get return a cursor bound to dbi in tx
+func (p *CursorPool) Get(tx *Tx, dbi DBI) (*Cursor, error) {
+	var cur *Cursor
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		cur = p.free[n-1]
+		p.free[n-1] = nil
+		p.free = p.free[:n-1]
+	}
+	p.mu.Unlock()
+
+	if cur == nil {
+		if cur = NewCursor(); cur == nil {
+			return nil, ErrENOMEM
+		}
+	}
+	if err := tx.Bind(cur, dbi); err != ErrSuccess {
+		cur.close()
+		return nil, err
+	}
+	return cur, nil
+}
+
+// Put give the cursor back, it may be kept after its transaction ended and is
+// bound again by the next Get.
+func (p *CursorPool) Put(cur *Cursor) {
+	p.mu.Lock()
+	if p.closed || len(p.free) >= p.maxIdle {
+		p.mu.Unlock()
+		cur.close()
+		return
+	}
+	p.free = append(p.free, cur)
+	p.mu.Unlock()
+}
+
+// Close free all unused cursors
+func (p *CursorPool) Close() {
+	p.mu.Lock()
+	free := p.free
+	p.free = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, cur := range free {
+		cur.close()
+	}
+}
@@ -0,0 +1,217 @@
+package gmdbx
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorTracking(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var (
+		dbi  DBI
+		open *Cursor
+	)
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		if dbi, e = tx.OpenDBI("cursors", DBCreate); e != ErrSuccess {
+			return e
+		}
+		k := ToVal(uint64(1))
+		if e = tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+			return e
+		}
+
+		closed, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		if open, e = tx.OpenCursor(dbi); e != ErrSuccess {
+			return e
+		}
+		assert.Equal(t, 2, tx.OpenCursors())
+		closed.Close()
+		assert.Equal(t, 1, tx.OpenCursors())
+		return nil
+	})
+	assert.NoError(t, err)
+	open.Close()
+
+	tx := &Tx{}
+	if e := db.env.Begin(tx, TxReadOnly); e != ErrSuccess {
+		t.Fatal(e)
+	}
+	for i := 0; i < 3; i++ {
+		if _, e := tx.OpenCursor(dbi); e != ErrSuccess {
+			t.Fatal(e)
+		}
+	}
+	assert.Equal(t, 3, tx.OpenCursors())
+	var kept []*Cursor
+	for _, ctx := range tx.cursors {
+		kept = append(kept, (*Cursor)(unsafe.Pointer(ctx.cursor)))
+	}
+	// closed cursors are not kept until the end of the transaction
+	for i := 0; i < 100; i++ {
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			t.Fatal(e)
+		}
+		cur.Close()
+	}
+	assert.Equal(t, 3, tx.OpenCursors())
+	assert.Less(t, len(tx.cursors), 10)
+	tx.Abort()
+	assert.Equal(t, 0, tx.OpenCursors())
+	for _, cur := range kept {
+		cur.Close()
+	}
+}
+
+func TestCursorAfterTxn(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	dbi := openLoaderDBI(t, db, "cursors", DBCreate)
+	for _, end := range []struct {
+		name  string
+		flags TxFlags
+		end   func(tx *Tx) Error
+	}{
+		{"commit", TxReadWrite, (*Tx).Commit},
+		{"abort", TxReadWrite, (*Tx).Abort},
+		{"read commit", TxReadOnly, (*Tx).Commit},
+		{"read abort", TxReadOnly, (*Tx).Abort},
+	} {
+		for _, renew := range []bool{false, true} {
+			tx := NewTransaction(db.env)
+			if e := db.env.Begin(tx, end.flags); e != ErrSuccess {
+				t.Fatal(end.name, e)
+			}
+			cur, e := tx.OpenCursor(dbi)
+			if e != ErrSuccess {
+				t.Fatal(end.name, e)
+			}
+			assert.Equal(t, ErrSuccess, cur.SetUserData(end.name))
+			assert.Equal(t, ErrSuccess, end.end(tx), end.name)
+
+			// the cursor outlives its transaction until it is closed
+			if renew {
+				tx = NewTransaction(db.env)
+				if e = db.env.Begin(tx, TxReadOnly); e != ErrSuccess {
+					t.Fatal(end.name, e)
+				}
+				assert.Equal(t, ErrSuccess, cur.Renew(tx), end.name)
+				k, v := Val{}, Val{}
+				assert.Equal(t, ErrNotFound, cur.Get(&k, &v, CursorFirst), end.name)
+				assert.Equal(t, end.name, cur.UserData())
+				cur.Close()
+				tx.Abort()
+				continue
+			}
+			assert.Equal(t, end.name, cur.UserData())
+			cur.Close()
+		}
+	}
+}
+
+func TestCursorPool(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var dbi DBI
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		if dbi, e = tx.OpenDBI("cursors", DBCreate); e != ErrSuccess {
+			return e
+		}
+		for i := 0; i < 10; i++ {
+			k := ToVal(uint64(i))
+			if e = tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+				return e
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	pool := NewCursorPool(4)
+	defer pool.Close()
+
+	var first *Cursor
+	for i := 0; i < 3; i++ {
+		err = db.View(func(tx *Tx) error {
+			cur, err := pool.Get(tx, dbi)
+			if err != nil {
+				return err
+			}
+			defer pool.Put(cur)
+			if first == nil {
+				first = cur
+			}
+			assert.Equal(t, first, cur, "cursor should be reused")
+
+			n := 0
+			k, v := Val{}, Val{}
+			for cur.Get(&k, &v, CursorNext) == ErrSuccess {
+				n++
+			}
+			assert.Equal(t, 10, n)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func BenchmarkOpenCursor(b *testing.B) {
+	db, err := newTestDb()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Update(func(tx *Tx) error {
+		dbi, _ := tx.OpenDBI("cursors", DBCreate)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			cur, _ := tx.OpenCursor(dbi)
+			cur.Close()
+		}
+		return nil
+	})
+}
+
+func BenchmarkCursorPool(b *testing.B) {
+	db, err := newTestDb()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	pool := NewCursorPool(16)
+	defer pool.Close()
+	db.Update(func(tx *Tx) error {
+		dbi, _ := tx.OpenDBI("cursors", DBCreate)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			cur, _ := pool.Get(tx, dbi)
+			pool.Put(cur)
+		}
+		return nil
+	})
+}
@@ -2,11 +2,34 @@ package gmdbx
 
 import (
 	"errors"
+	"sync"
 )
 
 type DB struct {
 	env  *Env
 	opts *Option
+
+	batchMu    sync.Mutex
+	batch      *batch
+	batchStats BatchStats
+
+	writersMu sync.Mutex
+	writers   map[*Writer]struct{}
+
+	indexesMu sync.Mutex
+	indexes   map[string]*Index
+
+	watchMu   sync.Mutex
+	watchHubs map[DBI]*watchHub
+
+	changelogMu sync.Mutex
+	changelog   *Changelog
+
+	ttlMu    sync.Mutex
+	ttlStats TTLStats
+	sweepers map[*Sweeper]struct{}
+
+	compactMu sync.Mutex
 }
 
 // New create new database
@@ -18,8 +41,12 @@ func New(path string) (*DB, error) {
 	opts := &DefaultOption
 	opts.Path = path
 	return &DB{
-		env:  env,
-		opts: opts,
+		env:       env,
+		opts:      opts,
+		writers:   make(map[*Writer]struct{}),
+		indexes:   make(map[string]*Index),
+		watchHubs: make(map[DBI]*watchHub),
+		sweepers:  make(map[*Sweeper]struct{}),
 	}, nil
 }
 
@@ -39,24 +66,27 @@ func (d *DB) SetOption(opts *Option) {
 }
 
 func (d *DB) Open() error {
-	err := d.env.SetGeometry(d.opts.Geometry)
-	if err != ErrSuccess {
+	if err := d.env.openWith(d.opts); err != ErrSuccess {
 		return errors.New(err.Error())
 	}
-	err = d.env.SetMaxDBS(d.opts.MaxDBS)
+	return nil
+}
+
+// openWith configure and open the environment as described by opts
+func (env *Env) openWith(opts *Option) Error {
+	err := env.SetGeometry(opts.Geometry)
 	if err != ErrSuccess {
-		return errors.New(err.Error())
+		return err
 	}
-	err = d.env.SetOption(OptTxnDpLimit, uint64(d.opts.TxnDpLimit))
+	err = env.SetMaxDBS(opts.MaxDBS)
 	if err != ErrSuccess {
-		return errors.New(err.Error())
+		return err
 	}
-	err = d.env.Open(d.opts.Path, d.opts.Flags, 0664)
+	err = env.SetOption(OptTxnDpLimit, uint64(opts.TxnDpLimit))
 	if err != ErrSuccess {
-		return errors.New(err.Error())
+		return err
 	}
-
-	return nil
+	return env.Open(opts.Path, opts.Flags, 0664)
 }
 
 func (d *DB) Update(fn func(tx *Tx) error) error {
@@ -89,6 +119,18 @@ func (d *DB) CloseDBI(dbi DBI) error {
 }
 
 func (d *DB) Close() error {
+	d.writersMu.Lock()
+	writers := make([]*Writer, 0, len(d.writers))
+	for w := range d.writers {
+		writers = append(writers, w)
+	}
+	d.writersMu.Unlock()
+	for _, w := range writers {
+		w.Close()
+	}
+	d.closeWatchers()
+	d.closeSweepers()
+
 	if err := d.env.Close(false); err != ErrSuccess {
 		return errors.New(err.Error())
 	}
@@ -0,0 +1,192 @@
+package gmdbx
+
+import (
+	"context"
+
+	"github.com/sunvim/gmdbx/keys"
+)
+
+// hookedDeleteBatch keys collected at once before deleting them through
+// Tx.Delete on tables with write hooks
+const hookedDeleteBatch = 1024
+
+// DeleteRange delete the keys from start up to but not including end, a nil
+// bound being open, with all their values, and return the number of pairs
+// deleted. Bounds are compared with the comparator of the table.
+//
+// Keys are deleted with a cursor, or through Tx.Delete on tables with write
+// hooks, such as indexed or TTL tables, so the hooks see every deletion.
+func (tx *Tx) DeleteRange(dbi DBI, start, end []byte) (int, error) {
+	n, _, err := tx.deleteRange(dbi, start, end, 0)
+	return n, err
+}
+
+// DeletePrefix delete the keys starting with prefix, see DeleteRange. The
+// table must be ordered bytewise, which the default comparator does.
+func (tx *Tx) DeletePrefix(dbi DBI, prefix []byte) (int, error) {
+	return tx.DeleteRange(dbi, prefix, keys.PrefixEnd(prefix))
+}
+
+// Truncate delete all pairs of dbi, keeping the table, and return how many
+// there were.
+func (tx *Tx) Truncate(dbi DBI) (int, error) {
+	var st Stats
+	if err := tx.DBIStat(dbi, &st); err != ErrSuccess {
+		return 0, err
+	}
+	if err := tx.Drop(dbi, false); err != ErrSuccess {
+		return 0, err
+	}
+	return int(st.Entries), nil
+}
+
+// DeleteRangeChunked delete the range like DeleteRange, committing a write
+// transaction every chunk keys so a large range does not exceed the dirty
+// pages limit of a transaction (OptTxnDpLimit). The deletion is not atomic:
+// when it fails or ctx is done, the chunks committed stay deleted and their
+// pairs are counted.
+func (d *DB) DeleteRangeChunked(ctx context.Context, dbi DBI, start, end []byte, chunk int) (int, error) {
+	if chunk <= 0 {
+		return 0, ErrEINVAL
+	}
+	total := 0
+	for more := true; more; {
+		var n int
+		err := d.UpdateContext(ctx, func(tx *Tx) (err error) {
+			n, more, err = tx.deleteRange(dbi, start, end, chunk)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// deleteRange delete up to limit keys of the range, all of them when limit is
+// 0, and report whether keys remain in the range.
+func (tx *Tx) deleteRange(dbi DBI, start, end []byte, limit int) (int, bool, error) {
+	if hooks := tx.env.writeHooks(dbi); hooks != nil {
+		return tx.hookedDeleteRange(dbi, start, end, limit)
+	}
+	flags, _, e := tx.DBIFlags(dbi)
+	if e != ErrSuccess {
+		return 0, false, e
+	}
+	var delFlags PutFlags
+	dups := flags&DBDupSort != 0
+	if dups {
+		delFlags = PutAllDups
+	}
+	cur, e := tx.OpenCursor(dbi)
+	if e != ErrSuccess {
+		return 0, false, e
+	}
+	defer cur.Close()
+
+	n, deleted := 0, 0
+	var k, v Val
+	e = rangeFirst(cur, start, &k, &v)
+	// after a deletion the cursor is on the next key, which NextNoDup returns
+	for ; e == ErrSuccess; e = cur.Get(&k, &v, CursorNextNoDup) {
+		if !inRange(tx, dbi, &k, end) {
+			return n, false, nil
+		}
+		if limit > 0 && deleted == limit {
+			return n, true, nil
+		}
+		count := 1
+		if dups {
+			if count, e = cur.Count(); e != ErrSuccess {
+				return n, false, e
+			}
+		}
+		if e = cur.Delete(delFlags); e != ErrSuccess {
+			return n, false, e
+		}
+		n += count
+		deleted++
+	}
+	if e != ErrNotFound {
+		return n, false, e
+	}
+	return n, false, nil
+}
+
+func rangeFirst(cur *Cursor, start []byte, k, v *Val) Error {
+	if start == nil {
+		return cur.Get(k, v, CursorFirst)
+	}
+	*k = bytesVal(start)
+	return cur.Get(k, v, CursorSetRange)
+}
+
+func inRange(tx *Tx, dbi DBI, k *Val, end []byte) bool {
+	if end == nil {
+		return true
+	}
+	e := bytesVal(end)
+	return tx.Cmp(dbi, k, &e) < 0
+}
+
+// hookedDeleteRange collect keys of the range in batches and delete them
+// through Tx.Delete, the deleted keys are gone when the next batch is read.
+func (tx *Tx) hookedDeleteRange(dbi DBI, start, end []byte, limit int) (int, bool, error) {
+	n, deleted := 0, 0
+	for {
+		batch := hookedDeleteBatch
+		if limit > 0 {
+			batch = min(batch, limit-deleted)
+		}
+		found, count, more, err := tx.rangeKeys(dbi, start, end, batch)
+		if err != nil {
+			return n, false, err
+		}
+		for _, key := range found {
+			k := bytesVal(key)
+			if e := tx.Delete(dbi, &k, nil); e != ErrSuccess {
+				return n, false, e
+			}
+		}
+		n += count
+		deleted += len(found)
+		if !more || (limit > 0 && deleted == limit) {
+			return n, more, nil
+		}
+	}
+}
+
+// rangeKeys return copies of up to limit keys of the range, the number of
+// their pairs, and whether other keys follow in the range.
+func (tx *Tx) rangeKeys(dbi DBI, start, end []byte, limit int) ([][]byte, int, bool, error) {
+	cur, e := tx.OpenCursor(dbi)
+	if e != ErrSuccess {
+		return nil, 0, false, e
+	}
+	defer cur.Close()
+
+	var (
+		found [][]byte
+		n     int
+		k, v  Val
+	)
+	for e = rangeFirst(cur, start, &k, &v); e == ErrSuccess; e = cur.Get(&k, &v, CursorNextNoDup) {
+		if !inRange(tx, dbi, &k, end) {
+			return found, n, false, nil
+		}
+		if len(found) == limit {
+			return found, n, true, nil
+		}
+		count, err := cur.Count()
+		if err != ErrSuccess {
+			return nil, 0, false, err
+		}
+		found = append(found, k.Bytes())
+		n += count
+	}
+	if e != ErrNotFound {
+		return nil, 0, false, e
+	}
+	return found, n, false, nil
+}
@@ -0,0 +1,120 @@
+package gmdbx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fillRange(t *testing.T, db *DB, dbi DBI, n int, dups bool) {
+	assert.NoError(t, db.update(func(tx *Tx) error {
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("k%03d", i)
+			if e := indexPut(tx, dbi, key, "a"); e != ErrSuccess {
+				return e
+			}
+			if dups {
+				if e := indexPut(tx, dbi, key, "b"); e != ErrSuccess {
+					return e
+				}
+			}
+		}
+		return nil
+	}))
+}
+
+func rangeKeyStrings(t *testing.T, db *DB, dbi DBI) []string {
+	keys, _ := loaderContents(t, db, dbi)
+	var out []string
+	for _, k := range keys {
+		if len(out) == 0 || out[len(out)-1] != string(k) {
+			out = append(out, string(k))
+		}
+	}
+	return out
+}
+
+func TestDeleteRange(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	assert.NoError(t, db.EnableTTL("range_hooked"))
+
+	for _, tc := range []struct {
+		name  string
+		flags DBFlags
+		dups  bool
+	}{
+		{"range_plain", DBCreate, false},
+		{"range_dups", DBCreate | DBDupSort, true},
+		{"range_hooked", DBCreate, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dbi := openLoaderDBI(t, db, tc.name, tc.flags)
+			fillRange(t, db, dbi, 20, tc.dups)
+			pairs := 1
+			if tc.dups {
+				pairs = 2
+			}
+			err := db.update(func(tx *Tx) error {
+				n, err := tx.DeleteRange(dbi, []byte("k005"), []byte("k010"))
+				assert.NoError(t, err)
+				assert.Equal(t, 5*pairs, n)
+				n, err = tx.DeleteRange(dbi, []byte("k005"), []byte("k010"))
+				assert.NoError(t, err)
+				assert.Zero(t, n)
+				n, err = tx.DeleteRange(dbi, []byte("k018"), nil)
+				assert.NoError(t, err)
+				assert.Equal(t, 2*pairs, n)
+				n, err = tx.DeleteRange(dbi, nil, []byte("k002"))
+				assert.NoError(t, err)
+				assert.Equal(t, 2*pairs, n)
+				n, err = tx.DeletePrefix(dbi, []byte("k01"))
+				assert.NoError(t, err)
+				assert.Equal(t, 8*pairs, n)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"k002", "k003", "k004"}, rangeKeyStrings(t, db, dbi))
+
+			err = db.update(func(tx *Tx) error {
+				n, err := tx.Truncate(dbi)
+				assert.NoError(t, err)
+				assert.Equal(t, 3*pairs, n)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Empty(t, rangeKeyStrings(t, db, dbi))
+		})
+	}
+}
+
+func TestDeleteRangeChunked(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "range_chunked", DBCreate|DBDupSort)
+	fillRange(t, db, dbi, 100, true)
+
+	var before, after EnvInfo
+	assert.Equal(t, ErrSuccess, db.env.envInfo(&before))
+	n, err := db.DeleteRangeChunked(context.Background(), dbi, []byte("k010"), []byte("k090"), 30)
+	assert.NoError(t, err)
+	assert.Equal(t, 160, n)
+	// 30, 30 then 20 keys
+	assert.Equal(t, ErrSuccess, db.env.envInfo(&after))
+	assert.Equal(t, before.RecentTxnID+3, after.RecentTxnID)
+	keys := rangeKeyStrings(t, db, dbi)
+	assert.Len(t, keys, 20)
+	assert.Equal(t, "k009", keys[9])
+	assert.Equal(t, "k090", keys[10])
+
+	_, err = db.DeleteRangeChunked(context.Background(), dbi, nil, nil, 0)
+	assert.ErrorIs(t, err, ErrEINVAL)
+}
@@ -0,0 +1,75 @@
+package gmdbx
+
+import (
+	"errors"
+)
+
+var ErrBadItemSize = errors.New("items length is not a multiple of item size")
+
+// PutFixedMulti store many fixed-size values of key in a DBDupFixed table with
+// PutMultiple, items holds the values back to back, each of itemSize bytes.
+// It returns the number of items written, which is less than requested only
+// on error.
+//
+// MDBX expects the data argument of a multiple put as an array of two Val, the
+// first one giving the size of one item and the address of the items, the
+// second one giving the number of items, which on return holds the number of
+// items actually written.
+func (cur *Cursor) PutFixedMulti(key []byte, itemSize int, items []byte) (written int, err error) {
+	if itemSize <= 0 || len(items)%itemSize != 0 {
+		return 0, ErrBadItemSize
+	}
+	count := len(items) / itemSize
+	k := bytesVal(key)
+	for written < count {
+		rest := items[written*itemSize:]
+		data := [2]Val{
+			{Base: &rest[0], Len: uint64(itemSize)},
+			{Len: uint64(count - written)},
+		}
+		if err := cur.Put(&k, &data[0], PutMultiple); err != ErrSuccess {
+			return written, err
+		}
+		if data[1].Len == 0 {
+			return written, ErrProblem
+		}
+		written += int(data[1].Len)
+	}
+	return written, nil
+}
+
+// ReadFixedPages call fn with the values of key in a DBDupFixed table, a page
+// at a time using CursorGetMultiple and CursorNextMultiple. The items and the
+// slice holding them are only valid until fn returns. ErrNotFound is returned
+// if key does not exist.
+func (cur *Cursor) ReadFixedPages(key []byte, fn func(items [][]byte) error) error {
+	k, v := bytesVal(key), Val{}
+	if err := cur.Get(&k, &v, CursorSet); err != ErrSuccess {
+		return err
+	}
+	itemSize := int(v.Len)
+	if itemSize == 0 {
+		return ErrBadValSize
+	}
+
+	var items [][]byte
+	op := CursorGetMultiple
+	for {
+		err := cur.Get(&k, &v, op)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != ErrSuccess {
+			return err
+		}
+		page := v.UnsafeBytes()
+		items = items[:0]
+		for off := 0; off+itemSize <= len(page); off += itemSize {
+			items = append(items, page[off:off+itemSize:off+itemSize])
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		op = CursorNextMultiple
+	}
+}
@@ -0,0 +1,71 @@
+package gmdbx
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedMulti(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	const n = 20000
+	ids := make([]byte, n*8)
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint64(ids[i*8:], uint64(i))
+	}
+
+	var dbi DBI
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		if dbi, e = tx.OpenDBI("postings", DBCreate|DBDupSort|DBDupFixed); e != ErrSuccess {
+			return e
+		}
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		defer cur.Close()
+
+		written, err := cur.PutFixedMulti([]byte("term"), 8, ids)
+		assert.Equal(t, n, written)
+		if err != nil {
+			return err
+		}
+		_, err = cur.PutFixedMulti([]byte("term"), 8, ids[:12])
+		assert.Equal(t, ErrBadItemSize, err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		defer cur.Close()
+
+		next, pages := uint64(0), 0
+		err := cur.ReadFixedPages([]byte("term"), func(items [][]byte) error {
+			pages++
+			for _, item := range items {
+				assert.Equal(t, next, binary.BigEndian.Uint64(item))
+				next++
+			}
+			return nil
+		})
+		assert.Equal(t, uint64(n), next)
+		assert.True(t, pages > 1, "items should span several pages")
+
+		assert.Equal(t, ErrNotFound, cur.ReadFixedPages([]byte("missing"), func(items [][]byte) error {
+			return nil
+		}))
+		return err
+	})
+	assert.NoError(t, err)
+}
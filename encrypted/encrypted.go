@@ -0,0 +1,396 @@
+// Package encrypted stores values of a gmdbx table encrypted with AES-GCM.
+//
+// Each stored value starts with a format byte and the ID of the key it is
+// encrypted with, followed by the nonce and the sealed data, so keys can be
+// rotated: new values use the current key of the KeyProvider, older values
+// stay readable as long as the provider returns their key, and Reencrypt
+// rewrites them with the current one. The stored key is authenticated with
+// the value, a value moved under another key fails to decrypt.
+//
+// With Options.HashKey the keys themselves are hidden: the table is keyed by
+// HMAC-SHA256 of the key, which still finds a key by its exact value but
+// loses the ordering, and the plain key is encrypted along with the value.
+//
+// Tables with DBDupSort are not supported.
+package encrypted
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sunvim/gmdbx"
+)
+
+var (
+	ErrDecrypt  = errors.New("encrypted: value can not be decrypted")
+	ErrFormat   = errors.New("encrypted: unknown value format")
+	ErrNoKey    = errors.New("encrypted: unknown key id")
+	ErrDupSort  = errors.New("encrypted: DBDupSort tables are not supported")
+	errKeyFrame = errors.New("encrypted: bad key framing")
+)
+
+const (
+	formatV1   = 1
+	headerSize = 1 + 4
+)
+
+// KeyProvider supplies the AES keys, of 16, 24 or 32 bytes, by ID
+type KeyProvider interface {
+	// Current return the ID of the key new values are encrypted with
+	Current() (uint32, error)
+	// Key return the key of id, wrapping ErrNoKey if it is unknown
+	Key(id uint32) ([]byte, error)
+}
+
+// Keys static KeyProvider
+type Keys struct {
+	CurrentID uint32
+	ByID      map[uint32][]byte
+}
+
+func (k *Keys) Current() (uint32, error) {
+	return k.CurrentID, nil
+}
+
+func (k *Keys) Key(id uint32) ([]byte, error) {
+	if key, ok := k.ByID[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoKey, id)
+}
+
+// Options configuration of a Bucket
+type Options struct {
+	// HashKey when set, store keys as their HMAC-SHA256 under HashKey. It can
+	// not be rotated, the same keys would no longer be found.
+	HashKey []byte
+}
+
+// Bucket encrypted view of a named table. Like gmdbx.Store it holds no
+// transaction and may be shared by goroutines. Returned slices are copies.
+type Bucket struct {
+	dbi     gmdbx.DBI
+	keys    KeyProvider
+	hashKey []byte
+
+	mu    sync.Mutex
+	aeads map[uint32]cipher.AEAD
+}
+
+// New open, or create with DBCreate in flags, the table name inside tx
+func New(tx *gmdbx.Tx, name string, flags gmdbx.DBFlags, keys KeyProvider, opts Options) (*Bucket, error) {
+	if flags&gmdbx.DBDupSort != 0 {
+		return nil, ErrDupSort
+	}
+	dbi, err := tx.OpenDBI(name, flags)
+	if err != gmdbx.ErrSuccess {
+		return nil, err
+	}
+	return &Bucket{
+		dbi:     dbi,
+		keys:    keys,
+		hashKey: append([]byte(nil), opts.HashKey...),
+		aeads:   map[uint32]cipher.AEAD{},
+	}, nil
+}
+
+// Open open the table name of the database, creating it if needed
+func Open(db *gmdbx.DB, name string, keys KeyProvider, opts Options) (*Bucket, error) {
+	var b *Bucket
+	err := db.UpdateContext(context.Background(), func(tx *gmdbx.Tx) (err error) {
+		b, err = New(tx, name, gmdbx.DBCreate, keys, opts)
+		return err
+	})
+	return b, err
+}
+
+// DBI return the handle of the table
+func (b *Bucket) DBI() gmdbx.DBI {
+	return b.dbi
+}
+
+func (b *Bucket) aead(id uint32) (cipher.AEAD, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a, ok := b.aeads[id]; ok {
+		return a, nil
+	}
+	key, err := b.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	b.aeads[id] = a
+	return a, nil
+}
+
+// storedKey return the key of the table for key
+func (b *Bucket) storedKey(key []byte) []byte {
+	if b.hashKey == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, b.hashKey)
+	mac.Write(key)
+	return mac.Sum(nil)
+}
+
+// seal encrypt value with the key id, stored under stored
+func (b *Bucket) seal(id uint32, stored, key, value []byte) ([]byte, error) {
+	a, err := b.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	plain := value
+	if b.hashKey != nil {
+		plain = binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(key)+len(value)), uint64(len(key)))
+		plain = append(append(plain, key...), value...)
+	}
+	out := make([]byte, headerSize+a.NonceSize(), headerSize+a.NonceSize()+len(plain)+a.Overhead())
+	out[0] = formatV1
+	binary.BigEndian.PutUint32(out[1:], id)
+	nonce := out[headerSize:]
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.Seal(out, nonce, plain, stored), nil
+}
+
+// open decrypt a stored value, returning the plain key and value
+func (b *Bucket) open(stored, data []byte) (key, value []byte, err error) {
+	id, err := keyID(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := b.aead(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < headerSize+a.NonceSize() {
+		return nil, nil, ErrDecrypt
+	}
+	nonce := data[headerSize : headerSize+a.NonceSize()]
+	plain, err := a.Open(nil, nonce, data[headerSize+a.NonceSize():], stored)
+	if err != nil {
+		return nil, nil, ErrDecrypt
+	}
+	if b.hashKey == nil {
+		return append([]byte(nil), stored...), plain, nil
+	}
+	n, size := binary.Uvarint(plain)
+	if size <= 0 || n > uint64(len(plain)-size) {
+		return nil, nil, errKeyFrame
+	}
+	return plain[size : size+int(n)], plain[size+int(n):], nil
+}
+
+func keyID(data []byte) (uint32, error) {
+	if len(data) < headerSize || data[0] != formatV1 {
+		return 0, ErrFormat
+	}
+	return binary.BigEndian.Uint32(data[1:]), nil
+}
+
+// get return the stored value of key, nil if it does not exist
+func (b *Bucket) get(tx *gmdbx.Tx, stored []byte) ([]byte, error) {
+	k, v := val(stored), gmdbx.Val{}
+	switch e := tx.Get(b.dbi, &k, &v); e {
+	case gmdbx.ErrSuccess:
+		return v.UnsafeBytes(), nil
+	case gmdbx.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, e
+	}
+}
+
+// Get return the value of key, false if key does not exist
+func (b *Bucket) Get(tx *gmdbx.Tx, key []byte) ([]byte, bool, error) {
+	stored := b.storedKey(key)
+	data, err := b.get(tx, stored)
+	if data == nil || err != nil {
+		return nil, false, err
+	}
+	_, value, err := b.open(stored, data)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// KeyID return the ID of the key the value of key is encrypted with
+func (b *Bucket) KeyID(tx *gmdbx.Tx, key []byte) (uint32, bool, error) {
+	data, err := b.get(tx, b.storedKey(key))
+	if data == nil || err != nil {
+		return 0, false, err
+	}
+	id, err := keyID(data)
+	return id, err == nil, err
+}
+
+// Put set the value of key, encrypted with the current key
+func (b *Bucket) Put(tx *gmdbx.Tx, key, value []byte) error {
+	id, err := b.keys.Current()
+	if err != nil {
+		return err
+	}
+	stored := b.storedKey(key)
+	data, err := b.seal(id, stored, key, value)
+	if err != nil {
+		return err
+	}
+	return b.put(tx, stored, data)
+}
+
+func (b *Bucket) put(tx *gmdbx.Tx, stored, data []byte) error {
+	k, v := val(stored), val(data)
+	if e := tx.Put(b.dbi, &k, &v, gmdbx.PutUpsert); e != gmdbx.ErrSuccess {
+		return e
+	}
+	return nil
+}
+
+// Delete remove key, false if it did not exist
+func (b *Bucket) Delete(tx *gmdbx.Tx, key []byte) (bool, error) {
+	stored := b.storedKey(key)
+	k := val(stored)
+	switch e := tx.Delete(b.dbi, &k, nil); e {
+	case gmdbx.ErrSuccess:
+		return true, nil
+	case gmdbx.ErrNotFound:
+		return false, nil
+	default:
+		return false, e
+	}
+}
+
+// ForEach call fn with every decrypted pair, in the order of the stored keys,
+// which is not the order of the keys with Options.HashKey. The slices are
+// only valid until fn returns.
+func (b *Bucket) ForEach(tx *gmdbx.Tx, fn func(key, value []byte) error) error {
+	return tx.ForEach(b.dbi, func(k, v []byte) error {
+		key, value, err := b.open(k, v)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+// ReencryptOptions configuration of Reencrypt
+type ReencryptOptions struct {
+	// BatchSize values rewritten per transaction, default 1000
+	BatchSize int
+}
+
+// Reencrypt rewrite with the current key every value encrypted with another
+// one, BatchSize values per write transaction so writers are not blocked for
+// long. It returns the number of values rewritten, also when it fails or ctx
+// is done.
+func (b *Bucket) Reencrypt(ctx context.Context, db *gmdbx.DB, opts ReencryptOptions) (int, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	id, err := b.keys.Current()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		total int
+		after []byte
+		done  bool
+	)
+	for !done {
+		var n int
+		err = db.UpdateContext(ctx, func(tx *gmdbx.Tx) error {
+			var err error
+			n, after, done, err = b.reencrypt(tx, id, after, opts.BatchSize)
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+type rewrite struct {
+	stored, data []byte
+}
+
+// reencrypt walk the table after the stored key after, rewriting up to limit
+// values, and return the last key visited and whether the walk ended.
+func (b *Bucket) reencrypt(tx *gmdbx.Tx, id uint32, after []byte, limit int) (int, []byte, bool, error) {
+	cur, e := tx.OpenCursor(b.dbi)
+	if e != gmdbx.ErrSuccess {
+		return 0, nil, false, e
+	}
+	var (
+		batch []rewrite
+		k, v  gmdbx.Val
+	)
+	if after == nil {
+		e = cur.Get(&k, &v, gmdbx.CursorFirst)
+	} else {
+		k = val(after)
+		e = cur.Get(&k, &v, gmdbx.CursorSetRange)
+		if e == gmdbx.ErrSuccess && string(k.UnsafeBytes()) == string(after) {
+			e = cur.Get(&k, &v, gmdbx.CursorNext)
+		}
+	}
+	for ; e == gmdbx.ErrSuccess && len(batch) < limit; e = cur.Get(&k, &v, gmdbx.CursorNext) {
+		stored, data := k.UnsafeBytes(), v.UnsafeBytes()
+		// never nil, which means the start, even for an empty key
+		after = append([]byte{}, stored...)
+		old, err := keyID(data)
+		if err != nil {
+			cur.Close()
+			return 0, nil, false, err
+		}
+		if old == id {
+			continue
+		}
+		key, value, err := b.open(stored, data)
+		if err == nil {
+			data, err = b.seal(id, stored, key, value)
+		}
+		if err != nil {
+			cur.Close()
+			return 0, nil, false, err
+		}
+		batch = append(batch, rewrite{stored: after, data: data})
+	}
+	cur.Close()
+	if e != gmdbx.ErrSuccess && e != gmdbx.ErrNotFound {
+		return 0, nil, false, e
+	}
+	for _, r := range batch {
+		if err := b.put(tx, r.stored, r.data); err != nil {
+			return 0, nil, false, err
+		}
+	}
+	return len(batch), after, e == gmdbx.ErrNotFound, nil
+}
+
+// val like gmdbx.Bytes, but an empty slice, a valid key, gives an empty Val
+func val(b []byte) gmdbx.Val {
+	if len(b) == 0 {
+		return gmdbx.Val{}
+	}
+	return gmdbx.Bytes(&b)
+}
@@ -0,0 +1,224 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sunvim/gmdbx"
+)
+
+func openDB(t *testing.T) *gmdbx.DB {
+	db, err := gmdbx.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func update(t *testing.T, db *gmdbx.DB, fn func(tx *gmdbx.Tx) error) {
+	assert.NoError(t, db.UpdateContext(context.Background(), fn))
+}
+
+func view(t *testing.T, db *gmdbx.DB, fn func(tx *gmdbx.Tx) error) {
+	assert.NoError(t, db.ViewContext(context.Background(), fn))
+}
+
+// raw return the pairs of the table as stored
+func raw(t *testing.T, db *gmdbx.DB, dbi gmdbx.DBI) map[string][]byte {
+	out := map[string][]byte{}
+	view(t, db, func(tx *gmdbx.Tx) error {
+		return tx.ForEach(dbi, func(k, v []byte) error {
+			out[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return out
+}
+
+func testKeys() *Keys {
+	return &Keys{CurrentID: 1, ByID: map[uint32][]byte{
+		1: bytes.Repeat([]byte{1}, 32),
+		2: bytes.Repeat([]byte{2}, 16),
+	}}
+}
+
+func TestBucket(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"plain keys", Options{}},
+		{"hashed keys", Options{HashKey: []byte("secret")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openDB(t)
+			b, err := Open(db, "pii", testKeys(), tc.opts)
+			assert.NoError(t, err)
+
+			update(t, db, func(tx *gmdbx.Tx) error {
+				assert.NoError(t, b.Put(tx, []byte("alice"), []byte("alice@example.com")))
+				assert.NoError(t, b.Put(tx, []byte("bob"), []byte("bob@example.com")))
+				assert.NoError(t, b.Put(tx, []byte("carol"), nil))
+				ok, err := b.Delete(tx, []byte("carol"))
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				ok, err = b.Delete(tx, []byte("carol"))
+				assert.NoError(t, err)
+				assert.False(t, ok)
+				return nil
+			})
+
+			view(t, db, func(tx *gmdbx.Tx) error {
+				v, ok, err := b.Get(tx, []byte("alice"))
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, "alice@example.com", string(v))
+				_, ok, err = b.Get(tx, []byte("carol"))
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				got := map[string]string{}
+				assert.NoError(t, b.ForEach(tx, func(k, v []byte) error {
+					got[string(k)] = string(v)
+					return nil
+				}))
+				assert.Equal(t, map[string]string{"alice": "alice@example.com", "bob": "bob@example.com"}, got)
+				return nil
+			})
+
+			// neither the values nor hashed keys are stored in clear
+			stored := raw(t, db, b.DBI())
+			assert.Len(t, stored, 2)
+			for k, v := range stored {
+				assert.False(t, bytes.Contains(v, []byte("example.com")))
+				if tc.opts.HashKey != nil {
+					assert.Len(t, k, 32)
+				}
+			}
+			_, ok := stored["alice"]
+			assert.Equal(t, tc.opts.HashKey == nil, ok)
+		})
+	}
+}
+
+func TestTampering(t *testing.T) {
+	db := openDB(t)
+	b, err := Open(db, "pii", testKeys(), Options{})
+	assert.NoError(t, err)
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return b.Put(tx, []byte("alice"), []byte("secret"))
+	})
+
+	// a value moved under another key is refused
+	data := raw(t, db, b.DBI())["alice"]
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return b.put(tx, []byte("mallory"), data)
+	})
+	view(t, db, func(tx *gmdbx.Tx) error {
+		_, _, err := b.Get(tx, []byte("mallory"))
+		assert.ErrorIs(t, err, ErrDecrypt)
+		return nil
+	})
+
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return b.put(tx, []byte("mallory"), []byte("x"))
+	})
+	view(t, db, func(tx *gmdbx.Tx) error {
+		_, _, err := b.Get(tx, []byte("mallory"))
+		assert.ErrorIs(t, err, ErrFormat)
+		return nil
+	})
+
+	err = db.UpdateContext(context.Background(), func(tx *gmdbx.Tx) error {
+		_, err := New(tx, "dups", gmdbx.DBCreate|gmdbx.DBDupSort, testKeys(), Options{})
+		return err
+	})
+	assert.ErrorIs(t, err, ErrDupSort)
+}
+
+func TestReencrypt(t *testing.T) {
+	db := openDB(t)
+	keys := testKeys()
+	b, err := Open(db, "pii", keys, Options{HashKey: []byte("secret")})
+	assert.NoError(t, err)
+	update(t, db, func(tx *gmdbx.Tx) error {
+		for i := 0; i < 25; i++ {
+			if err := b.Put(tx, []byte(fmt.Sprint("k", i)), []byte(fmt.Sprint("v", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	keys.CurrentID = 2
+	update(t, db, func(tx *gmdbx.Tx) error {
+		return b.Put(tx, []byte("k3"), []byte("v3"))
+	})
+	n, err := b.Reencrypt(context.Background(), db, ReencryptOptions{BatchSize: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 24, n)
+	n, err = b.Reencrypt(context.Background(), db, ReencryptOptions{})
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	// the old key can be retired
+	delete(keys.ByID, 1)
+	b, err = Open(db, "pii", keys, Options{HashKey: []byte("secret")})
+	assert.NoError(t, err)
+	view(t, db, func(tx *gmdbx.Tx) error {
+		for i := 0; i < 25; i++ {
+			key := []byte(fmt.Sprint("k", i))
+			v, ok, err := b.Get(tx, key)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, fmt.Sprint("v", i), string(v))
+			id, _, err := b.KeyID(tx, key)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(2), id)
+		}
+		return nil
+	})
+}
+
+func TestEmptyKey(t *testing.T) {
+	db := openDB(t)
+	keys := testKeys()
+	b, err := Open(db, "pii", keys, Options{})
+	assert.NoError(t, err)
+	update(t, db, func(tx *gmdbx.Tx) error {
+		assert.NoError(t, b.Put(tx, []byte{}, []byte("empty")))
+		assert.NoError(t, b.Put(tx, []byte("k"), []byte("v")))
+		return nil
+	})
+
+	// the empty key is the first one, a batch may end on it
+	keys.CurrentID = 2
+	n, err := b.Reencrypt(context.Background(), db, ReencryptOptions{BatchSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	view(t, db, func(tx *gmdbx.Tx) error {
+		v, ok, err := b.Get(tx, nil)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("empty"), v)
+		id, _, err := b.KeyID(tx, []byte{})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(2), id)
+		return nil
+	})
+	update(t, db, func(tx *gmdbx.Tx) error {
+		ok, err := b.Delete(tx, nil)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		return nil
+	})
+}
@@ -4,7 +4,9 @@ package gmdbx
 import "C"
 import (
 	"os"
+	"runtime/cgo"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -752,11 +754,35 @@ func Delete(path string, mode DeleteMode) Error {
 }
 
 type Env struct {
-	env    *C.MDBX_env
-	opened int64
-	info   EnvInfo
-	closed int64
-	mu     sync.Mutex
+	env      *C.MDBX_env
+	opened   int64
+	info     EnvInfo
+	closed   int64
+	mu       sync.Mutex
+	userData cgo.Handle
+
+	hooksMu    sync.Mutex
+	hooks      atomic.Pointer[hookSet]
+	tableHooks map[string][]writeHook // hooks following a table by name
+
+	publishMu sync.Mutex
+
+	ttl atomic.Pointer[ttlState]
+
+	gateMu   sync.Mutex
+	gate     *sync.Cond
+	writers  int          // write transactions begun and not ended
+	readers  atomic.Int64 // read transactions running
+	swapping atomic.Bool  // new transactions wait for Compact, set under gateMu
+	epoch    uint64       // times Compact reopened the environment
+
+	poolsMu sync.Mutex
+	pools   map[*ReadPool]struct{}
+
+	namesMu sync.Mutex
+	names   map[DBI]string // names of the open DBI handles
+
+	capture atomic.Pointer[compactLog]
 }
 
 // NewEnv brief Create an MDBX environment instance.
@@ -871,6 +897,12 @@ func (env *Env) MaxKeySize() int {
 	return int(C.mdbx_env_get_maxkeysize_ex(env.env, 0))
 }
 
+// pairSizeInPage largest key and value pair held by a leaf page of a table
+// without duplicates, larger ones go to overflow pages.
+func (env *Env) pairSizeInPage() int {
+	return int(C.mdbx_env_get_pairsize4page_max(env.env, 0))
+}
+
 // Close the environment and release the memory map.
 // ingroup c_opening
 //
@@ -926,6 +958,10 @@ func (env *Env) Close(dontSync bool) Error {
 	if err != ErrSuccess {
 		return err
 	}
+	if env.userData != 0 {
+		env.userData.Delete()
+		env.userData = 0
+	}
 	env.closed = time.Now().UnixNano()
 	return err
 }
@@ -1453,7 +1489,12 @@ func (env *Env) Sync(force, nonblock bool) Error {
 //
 // returns A non-zero error value on failure and 0 on success.
 func (env *Env) CloseDBI(dbi DBI) Error {
-	return Error(C.mdbx_dbi_close(env.env, (C.MDBX_dbi)(dbi)))
+	err := Error(C.mdbx_dbi_close(env.env, (C.MDBX_dbi)(dbi)))
+	if err == ErrSuccess {
+		env.forgetDBI(dbi)
+		env.dropHooks(dbi)
+	}
+	return err
 }
 
 // GetMaxDBS Controls the maximum number of named databases for the environment.
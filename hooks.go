@@ -0,0 +1,256 @@
+package gmdbx
+
+import "slices"
+
+// change a write done on a table with hooks. For DBDupSort tables old is the
+// first value of key.
+type change struct {
+	dbi    DBI
+	key    []byte
+	old    []byte
+	new    []byte
+	hasOld bool
+	hasNew bool
+}
+
+// writeHook observes the writes done on a table through Tx.Put, Tx.Replace,
+// Tx.Delete and Tx.Drop, inside the writing transaction. Writes through a
+// Cursor are not observed.
+type writeHook interface {
+	// check may refuse a change before it is written
+	check(tx *Tx, c *change) Error
+	// apply runs once the change is written
+	apply(tx *Tx, c *change) Error
+	// drop runs once all pairs of the table are removed
+	drop(tx *Tx, dbi DBI) Error
+}
+
+// hookRemover is implemented by hooks keeping state about their table,
+// removed runs once they are unregistered because the table was deleted by
+// Tx.Drop or its handle closed, so a table reusing the DBI does not inherit
+// them.
+type hookRemover interface {
+	removed(dbi DBI)
+}
+
+type hookSet map[DBI][]writeHook
+
+func (env *Env) writeHooks(dbi DBI) []writeHook {
+	if m := env.hooks.Load(); m != nil {
+		return (*m)[dbi]
+	}
+	return nil
+}
+
+// addHook register h for dbi, the set is copied so writers read it without
+// locking.
+func (env *Env) addHook(dbi DBI, h writeHook) {
+	env.hooksMu.Lock()
+	defer env.hooksMu.Unlock()
+	m := hookSet{}
+	if old := env.hooks.Load(); old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	m[dbi] = append(m[dbi][:len(m[dbi]):len(m[dbi])], h)
+	env.hooks.Store(&m)
+}
+
+// addTableHook register h for dbi like addHook, and again for the handle of
+// the table name each time it is opened after being deleted or closed.
+func (env *Env) addTableHook(dbi DBI, name string, h writeHook) {
+	env.hooksMu.Lock()
+	if env.tableHooks == nil {
+		env.tableHooks = map[string][]writeHook{}
+	}
+	env.tableHooks[name] = append(env.tableHooks[name], h)
+	env.hooksMu.Unlock()
+	env.addHook(dbi, h)
+}
+
+// attachTableHooks register the hooks following the table name which dbi,
+// its handle, does not have yet
+func (env *Env) attachTableHooks(dbi DBI, name string) {
+	env.hooksMu.Lock()
+	defer env.hooksMu.Unlock()
+	following := env.tableHooks[name]
+	if len(following) == 0 {
+		return
+	}
+	old := env.hooks.Load()
+	var current []writeHook
+	if old != nil {
+		current = (*old)[dbi]
+	}
+	var missing []writeHook
+	for _, h := range following {
+		if !slices.Contains(current, h) {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	m := hookSet{}
+	if old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	m[dbi] = append(current[:len(current):len(current)], missing...)
+	env.hooks.Store(&m)
+}
+
+func (env *Env) removeHook(dbi DBI, h writeHook) {
+	env.hooksMu.Lock()
+	defer env.hooksMu.Unlock()
+	old := env.hooks.Load()
+	if old == nil {
+		return
+	}
+	m := hookSet{}
+	for k, v := range *old {
+		m[k] = v
+	}
+	var kept []writeHook
+	for _, x := range m[dbi] {
+		if x != h {
+			kept = append(kept, x)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m, dbi)
+	} else {
+		m[dbi] = kept
+	}
+	env.hooks.Store(&m)
+}
+
+// dropHooks unregister all hooks of dbi
+func (env *Env) dropHooks(dbi DBI) {
+	env.hooksMu.Lock()
+	old := env.hooks.Load()
+	if old == nil || len((*old)[dbi]) == 0 {
+		env.hooksMu.Unlock()
+		return
+	}
+	m := hookSet{}
+	for k, v := range *old {
+		if k != dbi {
+			m[k] = v
+		}
+	}
+	env.hooks.Store(&m)
+	env.hooksMu.Unlock()
+
+	for _, h := range (*old)[dbi] {
+		if r, ok := h.(hookRemover); ok {
+			r.removed(dbi)
+		}
+	}
+
+	// the table was created again by the transaction which deleted it
+	env.namesMu.Lock()
+	name, ok := env.names[dbi]
+	env.namesMu.Unlock()
+	if ok {
+		env.attachTableHooks(dbi, name)
+	}
+}
+
+// oldValue copy the current value of key, even expired, the write may
+// overwrite a dirty page in place.
+func (tx *Tx) oldValue(c *change) Error {
+	k, v := bytesVal(c.key), Val{}
+	switch err := tx.get(c.dbi, &k, &v); err {
+	case ErrSuccess:
+		c.old, c.hasOld = v.Bytes(), true
+	case ErrNotFound:
+	default:
+		return err
+	}
+	return ErrSuccess
+}
+
+func runHooks(tx *Tx, hooks []writeHook, c *change, apply bool) Error {
+	for _, h := range hooks {
+		var err Error
+		if apply {
+			err = h.apply(tx, c)
+		} else {
+			err = h.check(tx, c)
+		}
+		if err != ErrSuccess {
+			return err
+		}
+	}
+	return ErrSuccess
+}
+
+func (tx *Tx) hookedPut(hooks []writeHook, dbi DBI, key, data *Val, flags PutFlags) Error {
+	// the value is unknown until the caller fills the reserved space
+	if flags&(PutReserve|PutMultiple) != 0 {
+		return ErrIncompatible
+	}
+	c := change{dbi: dbi, key: key.UnsafeBytes(), new: data.UnsafeBytes(), hasNew: true}
+	if err := tx.oldValue(&c); err != ErrSuccess {
+		return err
+	}
+	if err := runHooks(tx, hooks, &c, false); err != ErrSuccess {
+		return err
+	}
+	if err := tx.put(dbi, key, data, flags); err != ErrSuccess {
+		return err
+	}
+	return runHooks(tx, hooks, &c, true)
+}
+
+func (tx *Tx) hookedReplace(hooks []writeHook, dbi DBI, key, data, oldData *Val, flags PutFlags) Error {
+	if flags&(PutReserve|PutMultiple) != 0 {
+		return ErrIncompatible
+	}
+	c := change{dbi: dbi, key: key.UnsafeBytes()}
+	if data != nil {
+		c.new, c.hasNew = data.UnsafeBytes(), true
+	}
+	if err := tx.oldValue(&c); err != ErrSuccess {
+		return err
+	}
+	if err := runHooks(tx, hooks, &c, false); err != ErrSuccess {
+		return err
+	}
+	if err := tx.replace(dbi, key, data, oldData, flags); err != ErrSuccess {
+		return err
+	}
+	return runHooks(tx, hooks, &c, true)
+}
+
+func (tx *Tx) hookedDelete(hooks []writeHook, dbi DBI, key, data *Val) Error {
+	c := change{dbi: dbi, key: key.UnsafeBytes()}
+	if data != nil {
+		// only this pair is deleted, if it matches
+		c.old, c.hasOld = data.Bytes(), true
+	} else if err := tx.oldValue(&c); err != ErrSuccess {
+		return err
+	}
+	if err := runHooks(tx, hooks, &c, false); err != ErrSuccess {
+		return err
+	}
+	if err := tx.delete(dbi, key, data); err != ErrSuccess {
+		return err
+	}
+	return runHooks(tx, hooks, &c, true)
+}
+
+func (tx *Tx) hookedDrop(hooks []writeHook, dbi DBI, del bool) Error {
+	if err := tx.drop(dbi, del); err != ErrSuccess {
+		return err
+	}
+	for _, h := range hooks {
+		if err := h.drop(tx, dbi); err != ErrSuccess {
+			return err
+		}
+	}
+	return ErrSuccess
+}
@@ -0,0 +1,348 @@
+package gmdbx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrIndexExists  = errors.New("index already defined")
+	ErrUnknownIndex = errors.New("unknown index")
+)
+
+// Index secondary index of a table, kept in a DBDupSort table mapping each
+// index key to the keys of the pairs it was extracted from.
+//
+// Tx.Put, Tx.Replace, Tx.Delete and Tx.Drop on the table update the index in
+// the same transaction. Writes through a Cursor and reserved puts bypass it,
+// Tx.Put with PutReserve is refused with ErrIncompatible. A put giving a
+// unique index a key already used by another pair fails with ErrKeyExist
+// before anything is written.
+//
+// Definitions are not stored in the database, they must be made again each
+// time the database is opened.
+type Index struct {
+	db      *DB
+	name    string
+	table   DBI
+	dbi     DBI
+	extract func(key, value []byte) [][]byte
+	unique  bool
+}
+
+// IndexReport inconsistencies found by VerifyIndex
+type IndexReport struct {
+	Pairs    uint64 // pairs of the table checked
+	Entries  uint64 // entries of the index checked
+	Missing  uint64 // index keys of a pair absent from the index
+	Dangling uint64 // index entries not matching any pair of the table
+}
+
+// OK report whether the index matches the table
+func (r IndexReport) OK() bool {
+	return r.Missing == 0 && r.Dangling == 0
+}
+
+// DefineIndex maintain the index indexName of the table, both are created if
+// needed. extract returns the index keys of a pair, none if the pair is not
+// indexed, it may return slices of key and value. A new empty index of a
+// table holding pairs is built right away.
+func (d *DB) DefineIndex(table, indexName string, extract func(key, value []byte) [][]byte, unique bool) (*Index, error) {
+	d.indexesMu.Lock()
+	defer d.indexesMu.Unlock()
+	if _, ok := d.indexes[indexName]; ok {
+		return nil, ErrIndexExists
+	}
+
+	idx := &Index{db: d, name: indexName, extract: extract, unique: unique}
+	err := d.update(func(tx *Tx) error {
+		var err Error
+		if idx.table, err = tx.OpenDBI(table, DBCreate); err != ErrSuccess {
+			return err
+		}
+		flags, _, err := tx.DBIFlags(idx.table)
+		if err != ErrSuccess {
+			return err
+		}
+		if flags&DBDupSort != 0 {
+			return fmt.Errorf("index %s: table %s is DBDupSort: %w", indexName, table, ErrIncompatible)
+		}
+		if idx.dbi, err = tx.OpenDBI(indexName, DBCreate|DBDupSort); err != ErrSuccess {
+			return err
+		}
+
+		var tst, ist Stats
+		if err = tx.DBIStat(idx.table, &tst); err != ErrSuccess {
+			return err
+		}
+		if err = tx.DBIStat(idx.dbi, &ist); err != ErrSuccess {
+			return err
+		}
+		if ist.Entries == 0 && tst.Entries > 0 {
+			return idx.rebuild(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d.env.addHook(idx.table, idx)
+	d.indexes[indexName] = idx
+	return idx, nil
+}
+
+// removed forget the index of a deleted table, it can be defined again
+func (idx *Index) removed(dbi DBI) {
+	d := idx.db
+	d.indexesMu.Lock()
+	if d.indexes[idx.name] == idx {
+		delete(d.indexes, idx.name)
+	}
+	d.indexesMu.Unlock()
+}
+
+func (d *DB) index(name string) (*Index, error) {
+	d.indexesMu.Lock()
+	defer d.indexesMu.Unlock()
+	idx, ok := d.indexes[name]
+	if !ok {
+		return nil, ErrUnknownIndex
+	}
+	return idx, nil
+}
+
+// Name return the name of the index table
+func (idx *Index) Name() string {
+	return idx.name
+}
+
+// DBI return the handle of the index table
+func (idx *Index) DBI() DBI {
+	return idx.dbi
+}
+
+// Table return the handle of the indexed table
+func (idx *Index) Table() DBI {
+	return idx.table
+}
+
+// keys extract the distinct index keys of a pair
+func (idx *Index) keys(key, value []byte) [][]byte {
+	ks := idx.extract(key, value)
+	out := ks[:0:0]
+	for i, k := range ks {
+		dup := false
+		for _, p := range ks[:i] {
+			if bytes.Equal(p, k) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func containsKey(ks [][]byte, k []byte) bool {
+	for _, x := range ks {
+		if bytes.Equal(x, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// add insert the entry of an index key, a unique index refuses an index key
+// already used by another pair.
+func (idx *Index) add(tx *Tx, ikey, key []byte) Error {
+	k, v := bytesVal(ikey), bytesVal(key)
+	if idx.unique {
+		var cur Val
+		switch err := tx.Get(idx.dbi, &k, &cur); err {
+		case ErrSuccess:
+			if !bytes.Equal(cur.UnsafeBytes(), key) {
+				return ErrKeyExist
+			}
+			return ErrSuccess
+		case ErrNotFound:
+		default:
+			return err
+		}
+	}
+	err := tx.put(idx.dbi, &k, &v, PutNoDupData)
+	if err == ErrKeyExist {
+		return ErrSuccess
+	}
+	return err
+}
+
+func (idx *Index) check(tx *Tx, c *change) Error {
+	if !idx.unique || !c.hasNew {
+		return ErrSuccess
+	}
+	for _, ikey := range idx.keys(c.key, c.new) {
+		k, v := bytesVal(ikey), Val{}
+		switch err := tx.Get(idx.dbi, &k, &v); err {
+		case ErrSuccess:
+			if !bytes.Equal(v.UnsafeBytes(), c.key) {
+				return ErrKeyExist
+			}
+		case ErrNotFound:
+		default:
+			return err
+		}
+	}
+	return ErrSuccess
+}
+
+func (idx *Index) apply(tx *Tx, c *change) Error {
+	var olds, news [][]byte
+	if c.hasOld {
+		olds = idx.keys(c.key, c.old)
+	}
+	if c.hasNew {
+		news = idx.keys(c.key, c.new)
+	}
+	for _, ikey := range olds {
+		if containsKey(news, ikey) {
+			continue
+		}
+		k, v := bytesVal(ikey), bytesVal(c.key)
+		if err := tx.delete(idx.dbi, &k, &v); err != ErrSuccess && err != ErrNotFound {
+			return err
+		}
+	}
+	for _, ikey := range news {
+		if containsKey(olds, ikey) {
+			continue
+		}
+		if err := idx.add(tx, ikey, c.key); err != ErrSuccess {
+			return err
+		}
+	}
+	return ErrSuccess
+}
+
+func (idx *Index) drop(tx *Tx, dbi DBI) Error {
+	return tx.drop(idx.dbi, false)
+}
+
+// Lookup return copies of the keys of the pairs indexed under ikey
+func (idx *Index) Lookup(tx *Tx, ikey []byte) ([][]byte, error) {
+	cur, err := tx.OpenCursor(idx.dbi)
+	if err != ErrSuccess {
+		return nil, err
+	}
+	defer cur.Close()
+
+	var keys [][]byte
+	k, v := bytesVal(ikey), Val{}
+	for err = cur.Get(&k, &v, CursorSet); err == ErrSuccess; err = cur.Get(&k, &v, CursorNextDup) {
+		keys = append(keys, v.Bytes())
+	}
+	if err != ErrNotFound {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// LookupByIndex return copies of the keys of the pairs indexed under ikey by
+// the index indexName.
+func (d *DB) LookupByIndex(tx *Tx, indexName string, ikey []byte) ([][]byte, error) {
+	idx, err := d.index(indexName)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Lookup(tx, ikey)
+}
+
+// rebuild clear the index and extract it again from every pair of the table
+func (idx *Index) rebuild(tx *Tx) error {
+	if err := tx.drop(idx.dbi, false); err != ErrSuccess {
+		return err
+	}
+	return tx.ForEach(idx.table, func(k, v []byte) error {
+		for _, ikey := range idx.keys(k, v) {
+			if err := idx.add(tx, ikey, k); err != ErrSuccess {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RebuildIndex clear the index indexName and build it again from the table,
+// in a single write transaction.
+func (d *DB) RebuildIndex(indexName string) error {
+	idx, err := d.index(indexName)
+	if err != nil {
+		return err
+	}
+	return d.update(idx.rebuild)
+}
+
+// VerifyIndex compare the index indexName with its table in a read-only
+// transaction.
+func (d *DB) VerifyIndex(indexName string) (IndexReport, error) {
+	idx, err := d.index(indexName)
+	if err != nil {
+		return IndexReport{}, err
+	}
+	var r IndexReport
+	err = d.ViewContext(context.Background(), func(tx *Tx) error {
+		r, err = idx.verify(tx)
+		return err
+	})
+	return r, err
+}
+
+func (idx *Index) verify(tx *Tx) (IndexReport, error) {
+	var r IndexReport
+	icur, e := tx.OpenCursor(idx.dbi)
+	if e != ErrSuccess {
+		return r, e
+	}
+	defer icur.Close()
+
+	// every index key of every pair has its entry
+	err := tx.ForEach(idx.table, func(k, v []byte) error {
+		r.Pairs++
+		for _, ikey := range idx.keys(k, v) {
+			ik, iv := bytesVal(ikey), bytesVal(k)
+			switch e := icur.Get(&ik, &iv, CursorGetBoth); e {
+			case ErrSuccess:
+			case ErrNotFound:
+				r.Missing++
+			default:
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return r, err
+	}
+
+	// every entry points to a pair which still extracts its index key
+	err = tx.ForEach(idx.dbi, func(ikey, key []byte) error {
+		r.Entries++
+		k, v := bytesVal(key), Val{}
+		switch e := tx.Get(idx.table, &k, &v); e {
+		case ErrSuccess:
+			if !containsKey(idx.keys(key, v.UnsafeBytes()), ikey) {
+				r.Dangling++
+			}
+		case ErrNotFound:
+			r.Dangling++
+		default:
+			return e
+		}
+		return nil
+	})
+	return r, err
+}
@@ -0,0 +1,210 @@
+package gmdbx
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// index test values are "name|city"
+func indexField(i int) func(key, value []byte) [][]byte {
+	return func(key, value []byte) [][]byte {
+		fields := bytes.Split(value, []byte("|"))
+		if len(fields) <= i || len(fields[i]) == 0 {
+			return nil
+		}
+		return [][]byte{fields[i]}
+	}
+}
+
+func indexPut(tx *Tx, dbi DBI, key, value string) Error {
+	k, v := bytesVal([]byte(key)), bytesVal([]byte(value))
+	return tx.Put(dbi, &k, &v, PutUpsert)
+}
+
+func indexLookup(t *testing.T, db *DB, name, ikey string) []string {
+	var keys []string
+	err := db.update(func(tx *Tx) error {
+		found, err := db.LookupByIndex(tx, name, []byte(ikey))
+		for _, k := range found {
+			keys = append(keys, string(k))
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	return keys
+}
+
+func TestIndex(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	// pairs written before the index is defined are indexed by DefineIndex
+	dbi := openLoaderDBI(t, db, "users", DBCreate)
+	err = db.update(func(tx *Tx) error {
+		if e := indexPut(tx, dbi, "1", "ann|paris"); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	byCity, err := db.DefineIndex("users", "users_city", indexField(1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.DefineIndex("users", "users_name", indexField(0), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.DefineIndex("users", "users_city", indexField(1), false)
+	assert.Equal(t, ErrIndexExists, err)
+	assert.Equal(t, dbi, byCity.Table())
+	assert.Equal(t, []string{"1"}, indexLookup(t, db, "users_city", "paris"))
+	assert.Equal(t, []string{"1"}, indexLookup(t, db, "users_name", "ann"))
+
+	err = db.update(func(tx *Tx) error {
+		for _, kv := range [][2]string{{"2", "bob|paris"}, {"3", "cid|rome"}, {"4", "dan|"}} {
+			if e := indexPut(tx, dbi, kv[0], kv[1]); e != ErrSuccess {
+				return e
+			}
+		}
+		// the name is already used by 1, nothing is written
+		assert.Equal(t, ErrKeyExist, indexPut(tx, dbi, "5", "ann|oslo"))
+		// moving 2 to rome
+		if e := indexPut(tx, dbi, "2", "bob|rome"); e != ErrSuccess {
+			return e
+		}
+		k := bytesVal([]byte("3"))
+		if e := tx.Delete(dbi, &k, nil); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"1"}, indexLookup(t, db, "users_city", "paris"))
+	assert.Equal(t, []string{"2"}, indexLookup(t, db, "users_city", "rome"))
+	assert.Empty(t, indexLookup(t, db, "users_city", "oslo"))
+	assert.Empty(t, indexLookup(t, db, "users_name", "cid"))
+	assert.Equal(t, []string{"4"}, indexLookup(t, db, "users_name", "dan"))
+
+	for _, name := range []string{"users_city", "users_name"} {
+		r, err := db.VerifyIndex(name)
+		assert.NoError(t, err)
+		assert.True(t, r.OK(), "%s %+v", name, r)
+		assert.Equal(t, uint64(3), r.Pairs)
+	}
+
+	// a cursor write bypasses the indexes
+	err = db.update(func(tx *Tx) error {
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		defer cur.Close()
+		k, v := bytesVal([]byte("1")), bytesVal([]byte("ann|oslo"))
+		if e = cur.Put(&k, &v, PutUpsert); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	r, err := db.VerifyIndex("users_city")
+	assert.NoError(t, err)
+	assert.Equal(t, IndexReport{Pairs: 3, Entries: 2, Missing: 1, Dangling: 1}, r)
+
+	assert.NoError(t, db.RebuildIndex("users_city"))
+	r, err = db.VerifyIndex("users_city")
+	assert.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, []string{"1"}, indexLookup(t, db, "users_city", "oslo"))
+
+	// dropping the table clears its indexes
+	err = db.update(func(tx *Tx) error {
+		if e := tx.Drop(dbi, false); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, indexLookup(t, db, "users_name", "bob"))
+
+	_, err = db.VerifyIndex("nope")
+	assert.Equal(t, ErrUnknownIndex, err)
+}
+
+func TestIndexDupSort(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	openLoaderDBI(t, db, "multi", DBCreate|DBDupSort)
+	_, err = db.DefineIndex("multi", "multi_idx", indexField(0), false)
+	assert.ErrorIs(t, err, ErrIncompatible)
+}
+
+func TestIndexDeleteTable(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	dbi := openLoaderDBI(t, db, "users", DBCreate)
+	_, err = db.DefineIndex("users", "users_city", indexField(1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.EnableTTL("users"))
+
+	drop := func(abort bool) error {
+		return db.update(func(tx *Tx) error {
+			if e := tx.Drop(dbi, true); e != ErrSuccess {
+				return e
+			}
+			if abort {
+				return ErrNotFound
+			}
+			return nil
+		})
+	}
+
+	// an aborted deletion keeps the hooks
+	assert.Equal(t, ErrNotFound, drop(true))
+	_, err = db.index("users_city")
+	assert.NoError(t, err)
+	assert.NotNil(t, db.env.writeHooks(dbi))
+
+	// libmdbx forgets the handle of an aborted deletion
+	assert.Equal(t, dbi, openLoaderDBI(t, db, "users", 0))
+	assert.NoError(t, drop(false))
+	assert.Nil(t, db.env.writeHooks(dbi))
+	_, err = db.index("users_city")
+	assert.Equal(t, ErrUnknownIndex, err)
+
+	// a new table, possibly reusing the handle, is neither indexed nor expiring
+	other := openLoaderDBI(t, db, "other", DBCreate)
+	err = db.update(func(tx *Tx) error {
+		if e := indexPut(tx, other, "1", "ann|paris"); e != ErrSuccess {
+			return e
+		}
+		k, v := bytesVal([]byte("2")), bytesVal([]byte("bob|rome"))
+		assert.Equal(t, ErrIncompatible, tx.PutWithTTL(other, &k, &v, time.Hour))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	dbi = openLoaderDBI(t, db, "users", DBCreate)
+	_, err = db.DefineIndex("users", "users_city", indexField(1), false)
+	assert.NoError(t, err)
+	assert.Empty(t, indexLookup(t, db, "users_city", "paris"))
+	assert.NoError(t, db.EnableTTL("users"))
+}
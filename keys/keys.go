@@ -0,0 +1,106 @@
+// Package keys encodes values into byte strings whose lexicographic order is
+// the natural order of the values, so they sort correctly as keys of a table
+// using the default comparator.
+//
+// The Append functions write fixed width encodings, decoded by the functions
+// of the same name without the prefix. Tuple packs several values of mixed
+// types into a single key, following the FoundationDB tuple layer.
+package keys
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const signBit = 1 << 63
+
+// AppendUint64 append the 8 bytes big-endian encoding of v
+func AppendUint64(dst []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(dst, v)
+}
+
+// Uint64 decode a value encoded by AppendUint64
+func Uint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// AppendUint32 append the 4 bytes big-endian encoding of v
+func AppendUint32(dst []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(dst, v)
+}
+
+// Uint32 decode a value encoded by AppendUint32
+func Uint32(b []byte) uint32 {
+	return binary.BigEndian.Uint32(b)
+}
+
+// AppendInt64 append 8 bytes, negative values sort before positive ones
+func AppendInt64(dst []byte, v int64) []byte {
+	return binary.BigEndian.AppendUint64(dst, uint64(v)^signBit)
+}
+
+// Int64 decode a value encoded by AppendInt64
+func Int64(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b) ^ signBit)
+}
+
+// AppendInt32 append 4 bytes, negative values sort before positive ones
+func AppendInt32(dst []byte, v int32) []byte {
+	return binary.BigEndian.AppendUint32(dst, uint32(v)^(1<<31))
+}
+
+// Int32 decode a value encoded by AppendInt32
+func Int32(b []byte) int32 {
+	return int32(binary.BigEndian.Uint32(b) ^ (1 << 31))
+}
+
+// AppendFloat64 append 8 bytes in IEEE 754 total order: -NaN, -Inf, negative
+// values, -0, +0, positive values, +Inf, NaN.
+func AppendFloat64(dst []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(dst, encodeFloatBits(math.Float64bits(v)))
+}
+
+// Float64 decode a value encoded by AppendFloat64
+func Float64(b []byte) float64 {
+	return math.Float64frombits(decodeFloatBits(binary.BigEndian.Uint64(b)))
+}
+
+func encodeFloatBits(u uint64) uint64 {
+	if u&signBit != 0 {
+		return ^u
+	}
+	return u | signBit
+}
+
+func decodeFloatBits(u uint64) uint64 {
+	if u&signBit != 0 {
+		return u &^ signBit
+	}
+	return ^u
+}
+
+// AppendTime append 12 bytes, the signed seconds and the nanoseconds since the
+// Unix epoch, the location is not kept.
+func AppendTime(dst []byte, t time.Time) []byte {
+	dst = AppendInt64(dst, t.Unix())
+	return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond()))
+}
+
+// Time decode a value encoded by AppendTime, in UTC
+func Time(b []byte) time.Time {
+	return time.Unix(Int64(b), int64(binary.BigEndian.Uint32(b[8:]))).UTC()
+}
+
+// PrefixEnd return the first key greater than all keys starting with prefix,
+// nil if there is none because prefix is empty or only made of 0xff bytes.
+func PrefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end := append([]byte(nil), prefix[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package keys
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertSorted check that encoding the sorted values gives sorted keys
+func assertSorted(t *testing.T, encoded [][]byte) {
+	t.Helper()
+	for i := 1; i < len(encoded); i++ {
+		assert.Negative(t, bytes.Compare(encoded[i-1], encoded[i]), "keys %d and %d", i-1, i)
+	}
+}
+
+func TestInts(t *testing.T) {
+	i64 := []int64{math.MinInt64, -1 << 40, -256, -255, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}
+	var enc [][]byte
+	for _, v := range i64 {
+		b := AppendInt64(nil, v)
+		assert.Equal(t, v, Int64(b))
+		enc = append(enc, b)
+	}
+	assertSorted(t, enc)
+
+	i32 := []int32{math.MinInt32, -1, 0, 1, math.MaxInt32}
+	enc = enc[:0]
+	for _, v := range i32 {
+		b := AppendInt32(nil, v)
+		assert.Equal(t, v, Int32(b))
+		enc = append(enc, b)
+	}
+	assertSorted(t, enc)
+
+	enc = enc[:0]
+	for _, v := range []uint64{0, 1, 256, math.MaxUint64} {
+		b := AppendUint64(nil, v)
+		assert.Equal(t, v, Uint64(b))
+		enc = append(enc, b)
+	}
+	assertSorted(t, enc)
+	assert.Equal(t, uint32(7), Uint32(AppendUint32(nil, 7)))
+}
+
+func TestFloats(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64,
+		math.Copysign(0, -1), 0, math.SmallestNonzeroFloat64, 1.5, math.MaxFloat64, math.Inf(1)}
+	var enc [][]byte
+	for _, v := range values {
+		b := AppendFloat64(nil, v)
+		assert.Equal(t, math.Float64bits(v), math.Float64bits(Float64(b)))
+		enc = append(enc, b)
+	}
+	assertSorted(t, enc)
+	assert.True(t, math.IsNaN(Float64(AppendFloat64(nil, math.NaN()))))
+}
+
+func TestTime(t *testing.T) {
+	values := []time.Time{
+		time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		time.Unix(0, 0),
+		time.Unix(0, 1),
+		time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	var enc [][]byte
+	for _, v := range values {
+		b := AppendTime(nil, v)
+		assert.True(t, v.Equal(Time(b)))
+		enc = append(enc, b)
+	}
+	assertSorted(t, enc)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, []byte("ac"), PrefixEnd([]byte("ab")))
+	assert.Equal(t, []byte{0x02}, PrefixEnd([]byte{0x01, 0xff}))
+	assert.Nil(t, PrefixEnd([]byte{0xff, 0xff}))
+	assert.Nil(t, PrefixEnd(nil))
+}
+
+func TestTupleRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	in := Tuple{nil, []byte("a\x00b"), "str\x00", true, false, -1, int8(-128),
+		uint64(math.MaxUint64), int64(math.MinInt64), float32(-2.5), 3.25, now,
+		Tuple{nil, "nested", Tuple{int16(5)}}, []byte{}}
+	out, err := Unpack(in.Pack())
+	assert.NoError(t, err)
+
+	want := Tuple{nil, []byte("a\x00b"), "str\x00", true, false, int64(-1), int64(-128),
+		uint64(math.MaxUint64), int64(math.MinInt64), float32(-2.5), 3.25, now,
+		Tuple{nil, "nested", Tuple{int64(5)}}, []byte{}}
+	assert.Equal(t, want, out)
+
+	_, err = Unpack([]byte{codeString, 'a'})
+	assert.Equal(t, ErrBadTuple, err)
+	_, err = Unpack([]byte{0x7f})
+	assert.Equal(t, ErrBadTuple, err)
+	assert.Panics(t, func() { Tuple{struct{}{}}.Pack() })
+}
+
+func TestTupleOrder(t *testing.T) {
+	sorted := []Tuple{
+		{nil},
+		{[]byte("a")},
+		{[]byte("a"), nil},
+		{[]byte("a\x00")},
+		{[]byte("b")},
+		{"a"},
+		{"a", int64(math.MinInt64)},
+		{"a", -65536},
+		{"a", -256},
+		{"a", -1},
+		{"a", 0},
+		{"a", 1},
+		{"a", 256},
+		{"a", uint64(math.MaxUint64)},
+		{"a", 1.5},
+		{"b"},
+		{Tuple{1}},
+		{0},
+		{false},
+		{true},
+		{time.Unix(-1, 0)},
+		{time.Unix(1, 0)},
+	}
+	var enc [][]byte
+	for _, tu := range sorted {
+		enc = append(enc, tu.Pack())
+	}
+	assertSorted(t, enc)
+
+	rnd := rand.New(rand.NewSource(1))
+	ints := make([]int64, 1000)
+	for i := range ints {
+		ints[i] = rnd.Int63n(1<<40) - 1<<39
+	}
+	sort.Slice(ints, func(i, j int) bool { return ints[i] < ints[j] })
+	enc = enc[:0]
+	for _, v := range ints {
+		enc = append(enc, Tuple{"user", v, "x"}.Pack())
+	}
+	for i := 1; i < len(enc); i++ {
+		assert.LessOrEqual(t, bytes.Compare(enc[i-1], enc[i]), 0)
+	}
+
+	start, end := Tuple{"a"}.Range()
+	for _, tu := range sorted[6:14] {
+		k := tu.Pack()
+		assert.True(t, bytes.Compare(start, k) <= 0 && bytes.Compare(k, end) < 0, "%v", tu)
+	}
+	assert.Positive(t, bytes.Compare(Tuple{"b"}.Pack(), end))
+	assert.Negative(t, bytes.Compare(Tuple{"a"}.Pack(), start))
+}
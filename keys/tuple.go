@@ -0,0 +1,294 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrBadTuple = errors.New("keys: malformed tuple")
+
+// type codes of the FoundationDB tuple layer, time uses the first code of
+// the range reserved for user types.
+const (
+	codeNil     = 0x00
+	codeBytes   = 0x01
+	codeString  = 0x02
+	codeNested  = 0x05
+	codeIntZero = 0x14
+	codeFloat32 = 0x20
+	codeFloat64 = 0x21
+	codeFalse   = 0x26
+	codeTrue    = 0x27
+	codeTime    = 0x40
+)
+
+// Tuple ordered list of values packed into a single key, elements may be nil,
+// []byte, string, bool, any signed or unsigned integer type, float32,
+// float64, time.Time and nested Tuple.
+//
+// Packed tuples sort element by element: a prefix sorts before the tuples it
+// starts, integers sort numerically regardless of their encoded width and
+// values of different types sort by type code (nil, bytes, string, nested,
+// integers, floats, bools, time).
+type Tuple []any
+
+// Pack encode the tuple, it panics on an element of an unsupported type
+func (t Tuple) Pack() []byte {
+	return t.Append(nil)
+}
+
+// Append append the encoded tuple to dst
+func (t Tuple) Append(dst []byte) []byte {
+	for _, e := range t {
+		dst = appendElement(dst, e, false)
+	}
+	return dst
+}
+
+// Range return the bounds of the keys of all tuples starting with t, start
+// is inclusive and end exclusive.
+func (t Tuple) Range() (start, end []byte) {
+	p := t.Pack()
+	start = append(p[:len(p):len(p)], 0x00)
+	end = append(p, 0xff)
+	return start, end
+}
+
+func appendElement(dst []byte, e any, nested bool) []byte {
+	switch v := e.(type) {
+	case nil:
+		if nested {
+			return append(dst, codeNil, 0xff)
+		}
+		return append(dst, codeNil)
+	case []byte:
+		return appendEscaped(append(dst, codeBytes), v)
+	case string:
+		return appendEscaped(append(dst, codeString), []byte(v))
+	case Tuple:
+		dst = append(dst, codeNested)
+		for _, n := range v {
+			dst = appendElement(dst, n, true)
+		}
+		return append(dst, 0x00)
+	case bool:
+		if v {
+			return append(dst, codeTrue)
+		}
+		return append(dst, codeFalse)
+	case int:
+		return appendInt(dst, int64(v))
+	case int8:
+		return appendInt(dst, int64(v))
+	case int16:
+		return appendInt(dst, int64(v))
+	case int32:
+		return appendInt(dst, int64(v))
+	case int64:
+		return appendInt(dst, v)
+	case uint:
+		return appendUint(dst, uint64(v))
+	case uint8:
+		return appendUint(dst, uint64(v))
+	case uint16:
+		return appendUint(dst, uint64(v))
+	case uint32:
+		return appendUint(dst, uint64(v))
+	case uint64:
+		return appendUint(dst, v)
+	case float32:
+		u := math.Float32bits(v)
+		if u&(1<<31) != 0 {
+			u = ^u
+		} else {
+			u |= 1 << 31
+		}
+		return binary.BigEndian.AppendUint32(append(dst, codeFloat32), u)
+	case float64:
+		return AppendFloat64(append(dst, codeFloat64), v)
+	case time.Time:
+		return AppendTime(append(dst, codeTime), v)
+	}
+	panic(fmt.Sprintf("keys: unsupported tuple element type %T", e))
+}
+
+// appendEscaped append b terminated by 0x00, each 0x00 byte of b is written
+// as 0x00 0xff.
+func appendEscaped(dst, b []byte) []byte {
+	for {
+		i := bytes.IndexByte(b, 0x00)
+		if i < 0 {
+			break
+		}
+		dst = append(dst, b[:i+1]...)
+		dst = append(dst, 0xff)
+		b = b[i+1:]
+	}
+	dst = append(dst, b...)
+	return append(dst, 0x00)
+}
+
+func uintLen(u uint64) int {
+	n := 0
+	for ; u > 0; u >>= 8 {
+		n++
+	}
+	return n
+}
+
+func appendUint(dst []byte, u uint64) []byte {
+	n := uintLen(u)
+	dst = append(dst, byte(codeIntZero+n))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	return append(dst, buf[8-n:]...)
+}
+
+// appendInt encode negative values with their length as a code below zero
+// and the one's complement of their magnitude, so longer values sort first.
+func appendInt(dst []byte, v int64) []byte {
+	if v >= 0 {
+		return appendUint(dst, uint64(v))
+	}
+	mag := uint64(-v)
+	n := uintLen(mag)
+	dst = append(dst, byte(codeIntZero-n))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], ^mag)
+	return append(dst, buf[8-n:]...)
+}
+
+// Unpack decode a packed tuple. Integers decode as int64, or uint64 when they
+// do not fit, byte strings as []byte and times in UTC.
+func Unpack(b []byte) (Tuple, error) {
+	t, rest, err := unpack(b, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrBadTuple
+	}
+	return t, nil
+}
+
+func unpack(b []byte, nested bool) (Tuple, []byte, error) {
+	t := Tuple{}
+	for len(b) > 0 {
+		if nested && b[0] == 0x00 {
+			if len(b) > 1 && b[1] == 0xff {
+				t = append(t, nil)
+				b = b[2:]
+				continue
+			}
+			return t, b[1:], nil
+		}
+		e, rest, err := decodeElement(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		t = append(t, e)
+		b = rest
+	}
+	if nested {
+		return nil, nil, ErrBadTuple
+	}
+	return t, b, nil
+}
+
+func decodeElement(b []byte) (any, []byte, error) {
+	code := b[0]
+	b = b[1:]
+	switch {
+	case code == codeNil:
+		return nil, b, nil
+	case code == codeBytes:
+		return decodeEscaped(b)
+	case code == codeString:
+		s, rest, err := decodeEscaped(b)
+		return string(s), rest, err
+	case code == codeNested:
+		return unpack(b, true)
+	case code >= codeIntZero-8 && code <= codeIntZero+8:
+		return decodeInt(int(code)-codeIntZero, b)
+	case code == codeFloat32:
+		if len(b) < 4 {
+			return nil, nil, ErrBadTuple
+		}
+		u := binary.BigEndian.Uint32(b)
+		if u&(1<<31) != 0 {
+			u &^= 1 << 31
+		} else {
+			u = ^u
+		}
+		return math.Float32frombits(u), b[4:], nil
+	case code == codeFloat64:
+		if len(b) < 8 {
+			return nil, nil, ErrBadTuple
+		}
+		return Float64(b), b[8:], nil
+	case code == codeFalse:
+		return false, b, nil
+	case code == codeTrue:
+		return true, b, nil
+	case code == codeTime:
+		if len(b) < 12 {
+			return nil, nil, ErrBadTuple
+		}
+		return Time(b), b[12:], nil
+	}
+	return nil, nil, ErrBadTuple
+}
+
+func decodeEscaped(b []byte) ([]byte, []byte, error) {
+	var out []byte
+	for {
+		i := bytes.IndexByte(b, 0x00)
+		if i < 0 {
+			return nil, nil, ErrBadTuple
+		}
+		out = append(out, b[:i]...)
+		if i+1 < len(b) && b[i+1] == 0xff {
+			out = append(out, 0x00)
+			b = b[i+2:]
+			continue
+		}
+		if out == nil {
+			out = []byte{}
+		}
+		return out, b[i+1:], nil
+	}
+}
+
+func decodeInt(n int, b []byte) (any, []byte, error) {
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	if len(b) < n {
+		return nil, nil, ErrBadTuple
+	}
+	var buf [8]byte
+	if neg {
+		// restore the leading one bits of the complement
+		for i := range buf {
+			buf[i] = 0xff
+		}
+	}
+	copy(buf[8-n:], b[:n])
+	u := binary.BigEndian.Uint64(buf[:])
+	if neg {
+		mag := ^u
+		if mag > 1<<63 {
+			return nil, nil, ErrBadTuple
+		}
+		return -int64(mag), b[n:], nil
+	}
+	if u > math.MaxInt64 {
+		return u, b[n:], nil
+	}
+	return int64(u), b[n:], nil
+}
@@ -0,0 +1,437 @@
+package gmdbx
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrLoaderDone   = errors.New("loader already loaded or closed")
+)
+
+// DupPolicy how a Loader handles a key collected more than once
+type DupPolicy int
+
+const (
+	// DupOverwrite keep the value collected last
+	DupOverwrite DupPolicy = iota
+	// DupKeepFirst keep the value collected first
+	DupKeepFirst
+	// DupError fail the load with ErrDuplicateKey
+	DupError
+	// DupKeepAll keep every distinct value, for DBDupSort tables
+	DupKeepAll
+)
+
+// LoadProgress state of a Loader reported to LoaderOptions.Progress
+type LoadProgress struct {
+	Collected uint64 // pairs given to Collect
+	Runs      int    // sorted runs spilled to temp files
+	Loaded    uint64 // pairs written to the table
+	Txns      int    // write transactions committed
+}
+
+// LoaderOptions configuration of a Loader
+type LoaderOptions struct {
+	// BufferSize bytes of keys and values sorted in memory before a run is
+	// spilled to a temp file, default 256MB.
+	BufferSize int
+	// TempDir directory of the spilled runs, default os.TempDir().
+	TempDir string
+	// Duplicates policy for keys collected more than once.
+	Duplicates DupPolicy
+	// Compare order of the keys, it must match the comparator of the table,
+	// default bytes.Compare.
+	Compare func(a, b []byte) int
+	// CompareValues order of the values of a key for DupKeepAll, it must match
+	// the data comparator of the table, default bytes.Compare.
+	CompareValues func(a, b []byte) int
+	// Progress called after each spilled run and each committed transaction.
+	Progress func(LoadProgress)
+}
+
+// Loader bulk loads unsorted key/value pairs, similar to the ETL collector of
+// Erigon: pairs are buffered and sorted in memory, spilled to temp files as
+// sorted runs, then k-way merged and inserted in order with PutAppend, which
+// fills pages sequentially instead of splitting them. The load is split into
+// as many write transactions as needed to stay below the dirty pages limit
+// of a transaction, so it is not atomic.
+type Loader struct {
+	db   *DB
+	dbi  DBI
+	opts LoaderOptions
+
+	arena   []byte
+	entries []loaderEntry
+	runs    []*os.File
+
+	progress LoadProgress
+	done     bool
+}
+
+type loaderEntry struct {
+	off  int
+	klen int
+	vlen int
+}
+
+// NewLoader create a loader inserting into dbi
+func (d *DB) NewLoader(dbi DBI, opts LoaderOptions) *Loader {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 256 << 20
+	}
+	if opts.Compare == nil {
+		opts.Compare = bytes.Compare
+	}
+	if opts.CompareValues == nil {
+		opts.CompareValues = bytes.Compare
+	}
+	return &Loader{db: d, dbi: dbi, opts: opts}
+}
+
+// Collect buffer a pair, key and value are copied
+func (l *Loader) Collect(key, value []byte) error {
+	if l.done {
+		return ErrLoaderDone
+	}
+	l.entries = append(l.entries, loaderEntry{off: len(l.arena), klen: len(key), vlen: len(value)})
+	l.arena = append(l.arena, key...)
+	l.arena = append(l.arena, value...)
+	l.progress.Collected++
+	if len(l.arena)+len(l.entries)*24 >= l.opts.BufferSize {
+		return l.spill()
+	}
+	return nil
+}
+
+func (l *Loader) key(e loaderEntry) []byte {
+	return l.arena[e.off : e.off+e.klen : e.off+e.klen]
+}
+
+func (l *Loader) value(e loaderEntry) []byte {
+	return l.arena[e.off+e.klen : e.off+e.klen+e.vlen : e.off+e.klen+e.vlen]
+}
+
+// sortBuffer sort the buffered pairs by key, keeping the collection order of
+// equal keys, or by key and value for DupKeepAll.
+func (l *Loader) sortBuffer() {
+	sort.SliceStable(l.entries, func(i, j int) bool {
+		c := l.opts.Compare(l.key(l.entries[i]), l.key(l.entries[j]))
+		if c == 0 && l.opts.Duplicates == DupKeepAll {
+			return l.opts.CompareValues(l.value(l.entries[i]), l.value(l.entries[j])) < 0
+		}
+		return c < 0
+	})
+}
+
+// spill write the buffered pairs as a sorted run to a temp file
+func (l *Loader) spill() error {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	l.sortBuffer()
+
+	f, err := os.CreateTemp(l.opts.TempDir, "gmdbx-loader-*")
+	if err != nil {
+		return err
+	}
+	l.runs = append(l.runs, f)
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	var hdr [2 * binary.MaxVarintLen64]byte
+	for _, e := range l.entries {
+		n := binary.PutUvarint(hdr[:], uint64(e.klen))
+		n += binary.PutUvarint(hdr[n:], uint64(e.vlen))
+		if _, err = w.Write(hdr[:n]); err != nil {
+			return err
+		}
+		if _, err = w.Write(l.arena[e.off : e.off+e.klen+e.vlen]); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	l.arena = l.arena[:0]
+	l.entries = l.entries[:0]
+	l.progress.Runs = len(l.runs)
+	if l.opts.Progress != nil {
+		l.opts.Progress(l.progress)
+	}
+	return nil
+}
+
+// Load merge the collected pairs and insert them into the table, the loader
+// can not be used afterwards.
+func (l *Loader) Load() error {
+	if l.done {
+		return ErrLoaderDone
+	}
+	defer l.Close()
+
+	var sources []loaderSource
+	if len(l.runs) > 0 {
+		if err := l.spill(); err != nil {
+			return err
+		}
+		for _, f := range l.runs {
+			sources = append(sources, &fileSource{r: bufio.NewReaderSize(f, 1<<20)})
+		}
+	} else {
+		l.sortBuffer()
+		sources = append(sources, &memSource{l: l})
+	}
+
+	m := &loaderMerge{cmp: l.opts.Compare}
+	for i, src := range sources {
+		ok, err := src.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.items = append(m.items, mergeItem{src: src, run: i})
+		}
+	}
+	heap.Init(m)
+
+	pending, err := l.nextPair(m)
+	if err != nil {
+		return err
+	}
+	for pending != nil {
+		err = l.db.update(func(tx *Tx) error {
+			pending, err = l.write(tx, m, pending)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		l.progress.Txns++
+		if l.opts.Progress != nil {
+			l.opts.Progress(l.progress)
+		}
+	}
+	return nil
+}
+
+// write insert pairs until the merge is exhausted or the transaction is close
+// to its dirty pages limit, the pair which did not fit is returned.
+func (l *Loader) write(tx *Tx, m *loaderMerge, p *loaderPair) (*loaderPair, error) {
+	const checkEvery = 256
+
+	var info TxInfo
+	if err := tx.Info(&info); err != ErrSuccess {
+		return p, err
+	}
+	var st Stats
+	if err := tx.DBIStat(l.dbi, &st); err != ErrSuccess {
+		return p, err
+	}
+	// a pair may dirty a page on every level of the tree and a split
+	reserve := uint64(checkEvery) * uint64(st.Depth+2) * uint64(st.PageSize) * 2
+
+	flags := PutAppend
+	if l.opts.Duplicates == DupKeepAll {
+		flags = PutAppendDup
+	}
+	for n := 0; p != nil; n++ {
+		if n > 0 && n%checkEvery == 0 {
+			if err := tx.Info(&info); err != ErrSuccess {
+				return p, err
+			}
+			if info.SpaceLeftover < reserve {
+				return p, nil
+			}
+		}
+		k, v := bytesVal(p.key), bytesVal(p.value)
+		err := tx.Put(l.dbi, &k, &v, flags)
+		if err == ErrEKeyMismatch || err == ErrKeyExist {
+			// the table already holds greater keys, append is not possible
+			err = tx.Put(l.dbi, &k, &v, PutUpsert)
+		}
+		if err != ErrSuccess {
+			return p, err
+		}
+		l.progress.Loaded++
+
+		var e error
+		if p, e = l.nextPair(m); e != nil {
+			return p, e
+		}
+	}
+	return nil, nil
+}
+
+type loaderPair struct {
+	key   []byte
+	value []byte
+}
+
+// nextPair pop the next pair to insert, applying the duplicates policy
+func (l *Loader) nextPair(m *loaderMerge) (*loaderPair, error) {
+	if m.Len() == 0 {
+		return nil, nil
+	}
+	key, value, err := m.pop()
+	if err != nil {
+		return nil, err
+	}
+	p := &loaderPair{key: key, value: value}
+
+	for m.Len() > 0 {
+		head := m.items[0].src
+		c := l.opts.Compare(head.key(), p.key)
+		if c != 0 {
+			break
+		}
+		if l.opts.Duplicates == DupKeepAll {
+			if l.opts.CompareValues(head.value(), p.value) != 0 {
+				break
+			}
+			// identical pair
+			if _, _, err = m.pop(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if l.opts.Duplicates == DupError {
+			return nil, ErrDuplicateKey
+		}
+		_, v, err := m.pop()
+		if err != nil {
+			return nil, err
+		}
+		if l.opts.Duplicates == DupOverwrite {
+			p.value = v
+		}
+	}
+	return p, nil
+}
+
+// Close remove the temp files, pairs not loaded yet are discarded
+func (l *Loader) Close() error {
+	l.done = true
+	var err error
+	for _, f := range l.runs {
+		f.Close()
+		if e := os.Remove(f.Name()); e != nil && err == nil {
+			err = e
+		}
+	}
+	l.runs = nil
+	l.arena = nil
+	l.entries = nil
+	return err
+}
+
+type loaderSource interface {
+	next() (bool, error)
+	key() []byte
+	value() []byte
+}
+
+type memSource struct {
+	l   *Loader
+	pos int
+	cur loaderEntry
+}
+
+func (s *memSource) next() (bool, error) {
+	if s.pos >= len(s.l.entries) {
+		return false, nil
+	}
+	s.cur = s.l.entries[s.pos]
+	s.pos++
+	return true, nil
+}
+
+func (s *memSource) key() []byte   { return s.l.key(s.cur) }
+func (s *memSource) value() []byte { return s.l.value(s.cur) }
+
+type fileSource struct {
+	r    *bufio.Reader
+	k, v []byte
+}
+
+func (s *fileSource) next() (bool, error) {
+	klen, err := binary.ReadUvarint(s.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	vlen, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return false, err
+	}
+	// fresh buffers, the previous pair may still be referenced
+	buf := make([]byte, klen+vlen)
+	if _, err = io.ReadFull(s.r, buf); err != nil {
+		return false, err
+	}
+	s.k, s.v = buf[:klen:klen], buf[klen:]
+	return true, nil
+}
+
+func (s *fileSource) key() []byte   { return s.k }
+func (s *fileSource) value() []byte { return s.v }
+
+type mergeItem struct {
+	src loaderSource
+	run int
+}
+
+// loaderMerge heap of the sources ordered by their current key, equal keys
+// are ordered by run so the collection order is kept.
+type loaderMerge struct {
+	items []mergeItem
+	cmp   func(a, b []byte) int
+}
+
+func (m *loaderMerge) Len() int { return len(m.items) }
+
+func (m *loaderMerge) Less(i, j int) bool {
+	c := m.cmp(m.items[i].src.key(), m.items[j].src.key())
+	if c == 0 {
+		return m.items[i].run < m.items[j].run
+	}
+	return c < 0
+}
+
+func (m *loaderMerge) Swap(i, j int) { m.items[i], m.items[j] = m.items[j], m.items[i] }
+
+func (m *loaderMerge) Push(x any) { m.items = append(m.items, x.(mergeItem)) }
+
+func (m *loaderMerge) Pop() any {
+	it := m.items[len(m.items)-1]
+	m.items = m.items[:len(m.items)-1]
+	return it
+}
+
+// pop return the smallest pair and advance its source
+func (m *loaderMerge) pop() ([]byte, []byte, error) {
+	src := m.items[0].src
+	key, value := src.key(), src.value()
+	ok, err := src.next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		heap.Fix(m, 0)
+	} else {
+		heap.Pop(m)
+	}
+	return key, value, nil
+}
@@ -0,0 +1,157 @@
+package gmdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openLoaderDBI(t *testing.T, db *DB, name string, flags DBFlags) DBI {
+	var dbi DBI
+	err := db.Update(func(tx *Tx) error {
+		var e Error
+		dbi, e = tx.OpenDBI(name, flags)
+		if e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbi
+}
+
+func loaderContents(t *testing.T, db *DB, dbi DBI) (keys, values [][]byte) {
+	err := db.update(func(tx *Tx) error {
+		return tx.ForEach(dbi, func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, values
+}
+
+func TestLoader(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "loader", DBCreate)
+
+	// a dirty pages limit this low forces the load into several transactions
+	if e := db.env.SetOption(OptTxnDpLimit, 256); e != ErrSuccess {
+		t.Fatal(e)
+	}
+
+	const n = 20000
+	var last LoadProgress
+	l := db.NewLoader(dbi, LoaderOptions{
+		BufferSize: 64 << 10,
+		TempDir:    t.TempDir(),
+		Progress:   func(p LoadProgress) { last = p },
+	})
+	value := bytes.Repeat([]byte{'v'}, 100)
+	for _, i := range rand.Perm(n) {
+		key := binary.BigEndian.AppendUint64(nil, uint64(i))
+		assert.NoError(t, l.Collect(key, value))
+	}
+	// the overwrite policy keeps the value collected last
+	assert.NoError(t, l.Collect(binary.BigEndian.AppendUint64(nil, 7), []byte("first")))
+	assert.NoError(t, l.Collect(binary.BigEndian.AppendUint64(nil, 7), []byte("last")))
+	assert.NoError(t, l.Load())
+	assert.Equal(t, ErrLoaderDone, l.Collect(nil, nil))
+
+	assert.Equal(t, uint64(n+2), last.Collected)
+	assert.Equal(t, uint64(n), last.Loaded)
+	assert.Greater(t, last.Runs, 1)
+	assert.Greater(t, last.Txns, 1)
+
+	keys, values := loaderContents(t, db, dbi)
+	assert.Len(t, keys, n)
+	for i, k := range keys {
+		assert.Equal(t, uint64(i), binary.BigEndian.Uint64(k))
+	}
+	assert.Equal(t, []byte("last"), values[7])
+}
+
+func TestLoaderDuplicates(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	load := func(name string, flags DBFlags, policy DupPolicy) ([][]byte, [][]byte, error) {
+		dbi := openLoaderDBI(t, db, name, flags)
+		l := db.NewLoader(dbi, LoaderOptions{
+			BufferSize: 64,
+			TempDir:    t.TempDir(),
+			Duplicates: policy,
+		})
+		for _, kv := range [][2]string{{"b", "2"}, {"a", "1"}, {"b", "1"}, {"c", "3"}, {"b", "2"}} {
+			if err := l.Collect([]byte(kv[0]), []byte(kv[1])); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := l.Load(); err != nil {
+			return nil, nil, err
+		}
+		keys, values := loaderContents(t, db, dbi)
+		return keys, values, nil
+	}
+
+	_, values, err := load("first", DBCreate, DupKeepFirst)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, values)
+
+	_, values, err = load("last", DBCreate, DupOverwrite)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, values)
+
+	_, _, err = load("error", DBCreate, DupError)
+	assert.Equal(t, ErrDuplicateKey, err)
+
+	keys, values, err := load("all", DBCreate|DBDupSort, DupKeepAll)
+	assert.NoError(t, err)
+	assert.Equal(t, "abbc", string(bytes.Join(keys, nil)))
+	assert.Equal(t, "1123", string(bytes.Join(values, nil)))
+}
+
+func TestLoaderNonEmpty(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "loader", DBCreate)
+
+	err = db.Update(func(tx *Tx) error {
+		k, v := bytesVal([]byte("m")), bytesVal([]byte("old"))
+		if e := tx.Put(dbi, &k, &v, PutUpsert); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// keys before "m" can not be appended and fall back to a regular put
+	l := db.NewLoader(dbi, LoaderOptions{})
+	for _, k := range []string{"z", "a", "m", "b"} {
+		assert.NoError(t, l.Collect([]byte(k), []byte(fmt.Sprint("new-", k))))
+	}
+	assert.NoError(t, l.Load())
+
+	keys, values := loaderContents(t, db, dbi)
+	assert.Equal(t, "abmz", string(bytes.Join(keys, nil)))
+	assert.Equal(t, []byte("new-m"), values[2])
+}
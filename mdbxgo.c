@@ -1,4 +1,5 @@
 #include "mdbxgo.h"
+#include <pthread.h>
 
 int cmp_lexical(const MDBX_val *a, const MDBX_val *b) {
   if (a->iov_len == b->iov_len)
@@ -560,6 +561,13 @@ void do_mdbx_cursor_get(size_t arg0, size_t arg1) {
 	);
 }
 
+static void cursor_wrote(MDBX_cursor *cursor) {
+	cursor_ctx *ctx = (cursor_ctx*)mdbx_cursor_get_userctx(cursor);
+	if (ctx != NULL) {
+		ctx->wrote = 1;
+	}
+}
+
 void do_mdbx_cursor_put(size_t arg0, size_t arg1) {
 	mdbx_cursor_put_t* args = (mdbx_cursor_put_t*)(void*)arg0;
 	args->result = (int32_t)mdbx_cursor_put(
@@ -568,6 +576,9 @@ void do_mdbx_cursor_put(size_t arg0, size_t arg1) {
 		(MDBX_val*)(void*)args->data,
 		(MDBX_put_flags_t)args->flags
 	);
+	if (args->result == MDBX_SUCCESS) {
+		cursor_wrote((MDBX_cursor*)(void*)args->cursor);
+	}
 }
 
 void do_mdbx_cursor_del(size_t arg0, size_t arg1) {
@@ -576,6 +587,9 @@ void do_mdbx_cursor_del(size_t arg0, size_t arg1) {
 		(MDBX_cursor*)(void*)args->cursor,
 		(MDBX_put_flags_t)args->flags
 	);
+	if (args->result == MDBX_SUCCESS) {
+		cursor_wrote((MDBX_cursor*)(void*)args->cursor);
+	}
 }
 
 void do_mdbx_cursor_count(size_t arg0, size_t arg1) {
@@ -615,3 +629,147 @@ void do_mdbx_estimate_distance(size_t arg0, size_t arg1) {
 		(ptrdiff_t*)(void*)args->distance_items
 	);
 }
+
+void do_mdbx_thread_id(size_t arg0, size_t arg1) {
+	mdbx_thread_id_t* args = (mdbx_thread_id_t*)(void*)arg0;
+	args->id = (size_t)pthread_self();
+}
+
+void do_mdbx_txn_straggler(size_t arg0, size_t arg1) {
+	mdbx_txn_straggler_t* args = (mdbx_txn_straggler_t*)(void*)arg0;
+#pragma GCC diagnostic push
+#pragma GCC diagnostic ignored "-Wdeprecated-declarations"
+	args->result = (int32_t)mdbx_txn_straggler(
+		(MDBX_txn*)(void*)args->txn,
+		(int*)(void*)args->percent
+	);
+#pragma GCC diagnostic pop
+}
+
+void do_mdbx_env_set_userctx(size_t arg0, size_t arg1) {
+	mdbx_userctx_t* args = (mdbx_userctx_t*)(void*)arg0;
+	args->result = (int32_t)mdbx_env_set_userctx(
+		(MDBX_env*)(void*)args->handle,
+		(void*)args->ctx
+	);
+}
+
+void do_mdbx_txn_set_userctx(size_t arg0, size_t arg1) {
+	mdbx_userctx_t* args = (mdbx_userctx_t*)(void*)arg0;
+	args->result = (int32_t)mdbx_txn_set_userctx(
+		(MDBX_txn*)(void*)args->handle,
+		(void*)args->ctx
+	);
+}
+
+// do_mdbx_cursor_set_userctx store ctx as the data of the cursor_ctx,
+// allocating an untracked one on first use
+void do_mdbx_cursor_set_userctx(size_t arg0, size_t arg1) {
+	mdbx_userctx_t* args = (mdbx_userctx_t*)(void*)arg0;
+	MDBX_cursor *cursor = (MDBX_cursor*)(void*)args->handle;
+	cursor_ctx *ctx = (cursor_ctx*)mdbx_cursor_get_userctx(cursor);
+	if (ctx == NULL) {
+		if (args->ctx == 0) {
+			args->result = MDBX_SUCCESS;
+			return;
+		}
+		ctx = (cursor_ctx*)calloc(1, sizeof(cursor_ctx));
+		if (unlikely(ctx == NULL)) {
+			args->result = MDBX_ENOMEM;
+			return;
+		}
+		ctx->cursor = cursor;
+		args->result = (int32_t)mdbx_cursor_set_userctx(cursor, ctx);
+		if (unlikely(args->result != MDBX_SUCCESS)) {
+			free(ctx);
+			return;
+		}
+	}
+	ctx->data = args->ctx;
+	args->result = MDBX_SUCCESS;
+}
+
+void do_mdbx_cursor_get_userctx(size_t arg0, size_t arg1) {
+	mdbx_userctx_t* args = (mdbx_userctx_t*)(void*)arg0;
+	cursor_ctx *ctx = (cursor_ctx*)mdbx_cursor_get_userctx(
+		(MDBX_cursor*)(void*)args->handle
+	);
+	args->ctx = ctx != NULL ? ctx->data : 0;
+}
+
+// do_mdbx_cursor_close_ex close the cursor and return its data, the
+// cursor_ctx of a tracked cursor is only marked closed and freed by
+// do_mdbx_cursor_release
+void do_mdbx_cursor_close_ex(size_t arg0, size_t arg1) {
+	mdbx_cursor_close_ex_t* args = (mdbx_cursor_close_ex_t*)(void*)arg0;
+	MDBX_cursor *cursor = (MDBX_cursor*)(void*)args->cursor;
+	cursor_ctx *ctx = (cursor_ctx*)mdbx_cursor_get_userctx(cursor);
+	args->ctx = 0;
+	mdbx_cursor_close(cursor);
+	if (ctx == NULL) {
+		return;
+	}
+	args->ctx = ctx->data;
+	ctx->data = 0;
+	if (ctx->tracked) {
+		ctx->cursor = NULL;
+		ctx->closed = 1;
+	} else {
+		free(ctx);
+	}
+}
+
+void do_mdbx_cursor_open_tracked(size_t arg0, size_t arg1) {
+	mdbx_cursor_open_tracked_t* args = (mdbx_cursor_open_tracked_t*)(void*)arg0;
+	MDBX_cursor **cursor = (MDBX_cursor**)(void*)args->cursor;
+	cursor_ctx **ctx = (cursor_ctx**)(void*)args->ctx;
+	*ctx = (cursor_ctx*)calloc(1, sizeof(cursor_ctx));
+	if (unlikely(*ctx == NULL)) {
+		args->result = MDBX_ENOMEM;
+		return;
+	}
+	args->result = (int32_t)mdbx_cursor_open(
+		(MDBX_txn*)(void*)args->txn,
+		(MDBX_dbi)args->dbi,
+		cursor
+	);
+	if (unlikely(args->result != MDBX_SUCCESS)) {
+		free(*ctx);
+		*ctx = NULL;
+		return;
+	}
+	(*ctx)->cursor = *cursor;
+	(*ctx)->tracked = 1;
+	mdbx_cursor_set_userctx(*cursor, *ctx);
+}
+
+// do_mdbx_cursor_untrack free a tracked cursor_ctx whose cursor is closed,
+// the one of a cursor still open is left to its close
+void do_mdbx_cursor_untrack(size_t arg0, size_t arg1) {
+	cursor_ctx *ctx = (cursor_ctx*)(void*)arg0;
+	if (ctx->closed) {
+		free(ctx);
+	} else {
+		ctx->tracked = 0;
+	}
+}
+
+void do_mdbx_cmp(size_t arg0, size_t arg1) {
+	mdbx_cmp_t* args = (mdbx_cmp_t*)(void*)arg0;
+	args->result = (int32_t)mdbx_cmp(
+		(MDBX_txn*)(void*)args->txn,
+		(MDBX_dbi)args->dbi,
+		(MDBX_val*)(void*)args->a,
+		(MDBX_val*)(void*)args->b
+	);
+}
+
+void do_mdbx_dcmp(size_t arg0, size_t arg1) {
+	mdbx_cmp_t* args = (mdbx_cmp_t*)(void*)arg0;
+	args->result = (int32_t)mdbx_dcmp(
+		(MDBX_txn*)(void*)args->txn,
+		(MDBX_dbi)args->dbi,
+		(MDBX_val*)(void*)args->a,
+		(MDBX_val*)(void*)args->b
+	);
+}
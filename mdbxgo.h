@@ -351,4 +351,71 @@ typedef struct mdbx_estimate_distance_t {
 
 void do_mdbx_estimate_distance(size_t arg0, size_t arg1) ;
 
+typedef struct mdbx_thread_id_t {
+	size_t id;
+} mdbx_thread_id_t;
+
+void do_mdbx_thread_id(size_t arg0, size_t arg1) ;
+
+typedef struct mdbx_txn_straggler_t {
+	size_t txn;
+	size_t percent;
+	int32_t result;
+} mdbx_txn_straggler_t;
+
+void do_mdbx_txn_straggler(size_t arg0, size_t arg1) ;
+
+typedef struct mdbx_userctx_t {
+	size_t handle;
+	size_t ctx;
+	int32_t result;
+} mdbx_userctx_t;
+
+void do_mdbx_env_set_userctx(size_t arg0, size_t arg1) ;
+void do_mdbx_txn_set_userctx(size_t arg0, size_t arg1) ;
+void do_mdbx_cursor_set_userctx(size_t arg0, size_t arg1) ;
+void do_mdbx_cursor_get_userctx(size_t arg0, size_t arg1) ;
+
+typedef struct mdbx_cursor_close_ex_t {
+	size_t cursor;
+	size_t ctx;
+} mdbx_cursor_close_ex_t;
+
+void do_mdbx_cursor_close_ex(size_t arg0, size_t arg1) ;
+
+// cursor_ctx userctx of the cursors handled by Go, holding the value of
+// Cursor.SetUserData. The one of a cursor opened by Tx.OpenCursor is owned
+// by its transaction and outlives the cursor until the transaction ends,
+// then it goes with the cursor if it is still open.
+typedef struct cursor_ctx {
+	MDBX_cursor *cursor;
+	size_t data;
+	int32_t tracked;
+	int32_t closed;
+	int32_t wrote; // a write was done through the cursor
+} cursor_ctx;
+
+typedef struct mdbx_cursor_open_tracked_t {
+	size_t txn;
+	size_t cursor;
+	size_t ctx;
+	uint32_t dbi;
+	int32_t result;
+} mdbx_cursor_open_tracked_t;
+
+void do_mdbx_cursor_open_tracked(size_t arg0, size_t arg1) ;
+
+void do_mdbx_cursor_untrack(size_t arg0, size_t arg1) ;
+
+typedef struct mdbx_cmp_t {
+	size_t txn;
+	size_t a;
+	size_t b;
+	uint32_t dbi;
+	int32_t result;
+} mdbx_cmp_t;
+
+void do_mdbx_cmp(size_t arg0, size_t arg1) ;
+void do_mdbx_dcmp(size_t arg0, size_t arg1) ;
+
 #endif
\ No newline at end of file
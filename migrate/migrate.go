@@ -0,0 +1,239 @@
+// Package migrate applies ordered schema migrations to a gmdbx database.
+//
+// The schema version of the database is kept in Canary.Z, 0 for a database
+// never migrated. Each step runs in its own write transaction which also
+// stores the version reached, so a failing step leaves the database at the
+// version of the previous one. Canary.X and Canary.Y are left untouched.
+//
+// A database whose version is newer than the latest registered migration is
+// refused with ErrTooNew, so older code does not write a schema it does not
+// know.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sunvim/gmdbx"
+)
+
+var (
+	ErrTooNew         = errors.New("migrate: database is newer than the migrations")
+	ErrUnknownVersion = errors.New("migrate: unknown version")
+	ErrIrreversible   = errors.New("migrate: migration has no down step")
+	ErrConflict       = errors.New("migrate: version changed concurrently")
+	ErrInvalid        = errors.New("migrate: invalid migration")
+)
+
+// errDryRun abort the transaction of a dry run
+var errDryRun = errors.New("migrate: dry run")
+
+// Migration one schema version. Up moves the database from the previous
+// version to Version, Down, when set, moves it back.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      func(tx *gmdbx.Tx) error
+	Down    func(tx *gmdbx.Tx) error
+}
+
+// Options configuration of Migrate and To
+type Options struct {
+	// DryRun run every step in a single write transaction which is aborted,
+	// the database is left unchanged.
+	DryRun bool
+}
+
+// Step a migration applied, or planned by a dry run
+type Step struct {
+	Version uint64
+	Name    string
+	// Down the migration was reverted, the database is then at the version
+	// of the previous migration.
+	Down bool
+}
+
+// Migrator holds the migrations of a database
+type Migrator struct {
+	db         *gmdbx.DB
+	migrations []Migration
+}
+
+// New check the migrations, sorted by version, and the version of db, which
+// must be 0 or one of the migrations.
+func New(db *gmdbx.DB, migrations ...Migration) (*Migrator, error) {
+	m := &Migrator{db: db, migrations: append([]Migration(nil), migrations...)}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	for i, mig := range m.migrations {
+		if mig.Version == 0 || mig.Up == nil {
+			return nil, fmt.Errorf("%w: version %d", ErrInvalid, mig.Version)
+		}
+		if i > 0 && m.migrations[i-1].Version == mig.Version {
+			return nil, fmt.Errorf("%w: duplicate version %d", ErrInvalid, mig.Version)
+		}
+	}
+	if _, err := m.Version(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Latest return the version of the last migration, 0 without migrations
+func (m *Migrator) Latest() uint64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version return the schema version of the database
+func (m *Migrator) Version() (uint64, error) {
+	var version uint64
+	err := m.db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		var err error
+		version, err = m.version(tx)
+		return err
+	})
+	return version, err
+}
+
+func (m *Migrator) version(tx *gmdbx.Tx) (uint64, error) {
+	var c gmdbx.Canary
+	if err := tx.GetCanary(&c); err != gmdbx.ErrSuccess {
+		return 0, err
+	}
+	if c.Z > m.Latest() {
+		return 0, fmt.Errorf("%w: version %d, latest %d", ErrTooNew, c.Z, m.Latest())
+	}
+	if c.Z != 0 && m.index(c.Z) < 0 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, c.Z)
+	}
+	return c.Z, nil
+}
+
+func (m *Migrator) index(version uint64) int {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return i
+	}
+	return -1
+}
+
+// Migrate apply the pending migrations up to Latest
+func (m *Migrator) Migrate(ctx context.Context, opts Options) ([]Step, error) {
+	return m.To(ctx, m.Latest(), opts)
+}
+
+// To move the database to target, 0 or the version of a migration, running
+// Up steps forward or Down steps backward. The steps applied are returned,
+// also when a step fails.
+func (m *Migrator) To(ctx context.Context, target uint64, opts Options) ([]Step, error) {
+	if target != 0 && m.index(target) < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := m.plan(current, target)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return m.dryRun(ctx, current, plan)
+	}
+
+	var done []Step
+	for _, s := range plan {
+		err := m.db.UpdateContext(ctx, func(tx *gmdbx.Tx) error {
+			from, err := m.version(tx)
+			if err != nil {
+				return err
+			}
+			if from != current {
+				return fmt.Errorf("%w: expected %d, found %d", ErrConflict, current, from)
+			}
+			current, err = m.apply(tx, s)
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, s)
+	}
+	return done, nil
+}
+
+// plan list the steps from current to target
+func (m *Migrator) plan(current, target uint64) ([]Step, error) {
+	var plan []Step
+	if target >= current {
+		for _, mig := range m.migrations {
+			if mig.Version > current && mig.Version <= target {
+				plan = append(plan, Step{Version: mig.Version, Name: mig.Name})
+			}
+		}
+		return plan, nil
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > current || mig.Version <= target {
+			continue
+		}
+		if mig.Down == nil {
+			return nil, fmt.Errorf("%w: %d %s", ErrIrreversible, mig.Version, mig.Name)
+		}
+		plan = append(plan, Step{Version: mig.Version, Name: mig.Name, Down: true})
+	}
+	return plan, nil
+}
+
+// apply run s in tx and store the version reached
+func (m *Migrator) apply(tx *gmdbx.Tx, s Step) (uint64, error) {
+	i := m.index(s.Version)
+	mig, fn, version := m.migrations[i], m.migrations[i].Up, s.Version
+	if s.Down {
+		fn, version = mig.Down, 0
+		if i > 0 {
+			version = m.migrations[i-1].Version
+		}
+	}
+	if err := fn(tx); err != nil {
+		return 0, fmt.Errorf("migrate: %d %s: %w", mig.Version, mig.Name, err)
+	}
+	var c gmdbx.Canary
+	if err := tx.GetCanary(&c); err != gmdbx.ErrSuccess {
+		return 0, err
+	}
+	c.Z = version
+	if err := tx.PutCanary(&c); err != gmdbx.ErrSuccess {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (m *Migrator) dryRun(ctx context.Context, current uint64, plan []Step) ([]Step, error) {
+	var done []Step
+	err := m.db.UpdateContext(ctx, func(tx *gmdbx.Tx) error {
+		from, err := m.version(tx)
+		if err != nil {
+			return err
+		}
+		if from != current {
+			return fmt.Errorf("%w: expected %d, found %d", ErrConflict, current, from)
+		}
+		for _, s := range plan {
+			if _, err := m.apply(tx, s); err != nil {
+				return err
+			}
+			done = append(done, s)
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return done, err
+}
@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sunvim/gmdbx"
+)
+
+func openDB(t *testing.T) *gmdbx.DB {
+	db, err := gmdbx.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTable return a step creating the named table
+func createTable(name string) func(tx *gmdbx.Tx) error {
+	return func(tx *gmdbx.Tx) error {
+		if _, err := tx.OpenDBI(name, gmdbx.DBCreate); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	}
+}
+
+func dropTable(name string) func(tx *gmdbx.Tx) error {
+	return func(tx *gmdbx.Tx) error {
+		dbi, err := tx.OpenDBI(name, 0)
+		if err != gmdbx.ErrSuccess {
+			return err
+		}
+		if err = tx.Drop(dbi, true); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	}
+}
+
+func tables(t *testing.T, db *gmdbx.DB, names ...string) []string {
+	var found []string
+	err := db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		for _, name := range names {
+			switch _, err := tx.OpenDBI(name, 0); err {
+			case gmdbx.ErrSuccess:
+				found = append(found, name)
+			case gmdbx.ErrNotFound:
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return found
+}
+
+func canary(t *testing.T, db *gmdbx.DB) gmdbx.Canary {
+	var c gmdbx.Canary
+	assert.NoError(t, db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		if err := tx.GetCanary(&c); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	}))
+	return c
+}
+
+var testMigrations = []Migration{
+	{Version: 3, Name: "orders", Up: createTable("orders"), Down: dropTable("orders")},
+	{Version: 1, Name: "users", Up: createTable("users"), Down: dropTable("users")},
+	{Version: 2, Name: "items", Up: createTable("items")},
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	assert.NoError(t, db.UpdateContext(ctx, func(tx *gmdbx.Tx) error {
+		if err := tx.PutCanary(&gmdbx.Canary{X: 7, Y: 8}); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	}))
+	m, err := New(db, testMigrations...)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), m.Latest())
+
+	// a dry run leaves the database unchanged
+	steps, err := m.Migrate(ctx, Options{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Step{{1, "users", false}, {2, "items", false}, {3, "orders", false}}, steps)
+	version, err := m.Version()
+	assert.NoError(t, err)
+	assert.Zero(t, version)
+	assert.Empty(t, tables(t, db, "users", "items", "orders"))
+
+	steps, err = m.To(ctx, 2, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+	steps, err = m.Migrate(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Step{{3, "orders", false}}, steps)
+	assert.Equal(t, []string{"users", "items", "orders"}, tables(t, db, "users", "items", "orders"))
+	c := canary(t, db)
+	assert.Equal(t, []uint64{7, 8, 3}, []uint64{c.X, c.Y, c.Z})
+
+	// nothing pending
+	steps, err = m.Migrate(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+
+	// down steps, items has none
+	_, err = m.To(ctx, 0, Options{})
+	assert.ErrorIs(t, err, ErrIrreversible)
+	steps, err = m.To(ctx, 2, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Step{{3, "orders", true}}, steps)
+	assert.Equal(t, []string{"users", "items"}, tables(t, db, "users", "items", "orders"))
+	_, err = m.To(ctx, 5, Options{})
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+
+	// older code refuses the database
+	_, err = New(db, testMigrations[1])
+	assert.ErrorIs(t, err, ErrTooNew)
+	_, err = New(db, testMigrations[0], testMigrations[1])
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+	_, err = New(db, testMigrations[1], testMigrations[1])
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestMigrateFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	boom := errors.New("boom")
+	m, err := New(db,
+		Migration{Version: 1, Name: "users", Up: createTable("users")},
+		Migration{Version: 2, Name: "broken", Up: func(tx *gmdbx.Tx) error {
+			if err := createTable("broken")(tx); err != nil {
+				return err
+			}
+			return boom
+		}},
+	)
+	assert.NoError(t, err)
+
+	steps, err := m.Migrate(ctx, Options{})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []Step{{1, "users", false}}, steps)
+	version, err := m.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), version)
+	assert.Equal(t, []string{"users"}, tables(t, db, "users", "broken"))
+
+	// a dry run fails like the migration itself
+	steps, err = m.Migrate(ctx, Options{DryRun: true})
+	assert.ErrorIs(t, err, boom)
+	assert.Empty(t, steps)
+}
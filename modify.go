@@ -0,0 +1,129 @@
+package gmdbx
+
+import (
+	"bytes"
+	"errors"
+	"unsafe"
+)
+
+var ErrNotCounter = errors.New("value is not an 8-byte counter")
+
+// Modify read the value of key, the boolean reports whether it exists, and
+// write what fn returns: the new value, or a deletion when del is set. old is
+// a copy fn may keep or return modified. Nothing is written if fn fails.
+//
+// mdbx_replace needs the new value before it looks the key up, so the value
+// is read first and the write is done by Replace, which checks that the key
+// is still present, or absent, and runs the write hooks of the table. For
+// DBDupSort tables a key with several values fails with ErrEMultiVal.
+func (tx *Tx) Modify(dbi DBI, key *Val, fn func(old []byte, exists bool) (new []byte, del bool, err error)) error {
+	var v Val
+	present := true
+	switch err := tx.get(dbi, key, &v); err {
+	case ErrSuccess:
+	case ErrNotFound:
+		present = false
+	default:
+		return err
+	}
+	// an expired pair does not exist for fn but is still overwritten
+	exists := present
+	if st, t := tx.env.ttlTable(dbi); t != nil && present {
+		var live Val
+		switch err := tx.getLive(st, t, dbi, key, &live); err {
+		case ErrSuccess:
+		case ErrNotFound:
+			exists = false
+		default:
+			return err
+		}
+	}
+	var old []byte
+	if exists {
+		old = v.Bytes()
+	}
+	data, del, err := fn(old, exists)
+	if err != nil {
+		return err
+	}
+	if del {
+		if !exists {
+			return nil
+		}
+		return tx.replaceKnown(dbi, key, nil, true, int(v.Len), true)
+	}
+	return tx.replaceKnown(dbi, key, data, false, int(v.Len), present)
+}
+
+// replaceKnown write data, or delete when del is set, the value of key being
+// known to exist with size bytes or not to exist.
+func (tx *Tx) replaceKnown(dbi DBI, key *Val, data []byte, del bool, size int, exists bool) error {
+	flags := PutNoOverwrite
+	if exists {
+		flags = PutCurrent
+	}
+	// mdbx_replace copies the previous value here, it must be large enough
+	// and never share the address of data, even empty
+	prev := bytesVal(make([]byte, max(size, 1)))
+	var err Error
+	if del {
+		err = tx.Replace(dbi, key, nil, &prev, flags)
+	} else {
+		d := bytesVal(data)
+		err = tx.Replace(dbi, key, &d, &prev, flags)
+	}
+	if err != ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+// Incr add delta to the counter of key, a missing key counting as 0, and
+// return the new value. Counters are int64 in native byte order, as written
+// by I64 and read by Val.I64.
+func (tx *Tx) Incr(dbi DBI, key *Val, delta int64) (int64, error) {
+	var n int64
+	err := tx.Modify(dbi, key, func(old []byte, exists bool) ([]byte, bool, error) {
+		if exists {
+			if len(old) != 8 {
+				return nil, false, ErrNotCounter
+			}
+			n = *(*int64)(unsafe.Pointer(&old[0]))
+		}
+		n += delta
+		out := make([]byte, 8)
+		*(*int64)(unsafe.Pointer(&out[0])) = n
+		return out, false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CAS set the value of key to value if its current one is expected, a nil
+// expected meaning the key must not exist and a nil value deleting it. It
+// reports whether the value was swapped.
+func (tx *Tx) CAS(dbi DBI, key *Val, expected, value []byte) (bool, error) {
+	swapped := false
+	err := tx.Modify(dbi, key, func(old []byte, exists bool) ([]byte, bool, error) {
+		if exists != (expected != nil) || !bytes.Equal(old, expected) {
+			return nil, false, errNoSwap
+		}
+		swapped = true
+		return value, value == nil, nil
+	})
+	if err == errNoSwap {
+		return false, nil
+	}
+	return swapped, err
+}
+
+var errNoSwap = errors.New("value differs from the expected one")
+
+// Append add data at the end of the value of key, creating it if needed
+func (tx *Tx) Append(dbi DBI, key *Val, data []byte) error {
+	return tx.Modify(dbi, key, func(old []byte, exists bool) ([]byte, bool, error) {
+		return append(old, data...), false, nil
+	})
+}
@@ -0,0 +1,140 @@
+package gmdbx
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModify(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "modify", DBCreate)
+	multi := openLoaderDBI(t, db, "modify_multi", DBCreate|DBDupSort)
+
+	err = db.update(func(tx *Tx) error {
+		k := bytesVal([]byte("a"))
+		// insert, update, delete
+		assert.NoError(t, tx.Modify(dbi, &k, func(old []byte, exists bool) ([]byte, bool, error) {
+			assert.False(t, exists)
+			return []byte("1"), false, nil
+		}))
+		assert.NoError(t, tx.Modify(dbi, &k, func(old []byte, exists bool) ([]byte, bool, error) {
+			assert.True(t, exists)
+			assert.Equal(t, "1", string(old))
+			return append(old, "23"...), false, nil
+		}))
+		v, _ := ttlGet(tx, dbi, "a")
+		assert.Equal(t, "123", v)
+		boom := errors.New("boom")
+		assert.ErrorIs(t, tx.Modify(dbi, &k, func([]byte, bool) ([]byte, bool, error) {
+			return []byte("x"), false, boom
+		}), boom)
+		v, _ = ttlGet(tx, dbi, "a")
+		assert.Equal(t, "123", v)
+		assert.NoError(t, tx.Modify(dbi, &k, func([]byte, bool) ([]byte, bool, error) {
+			return nil, true, nil
+		}))
+		_, e := ttlGet(tx, dbi, "a")
+		assert.Equal(t, ErrNotFound, e)
+		assert.NoError(t, tx.Modify(dbi, &k, func([]byte, bool) ([]byte, bool, error) {
+			return nil, true, nil
+		}))
+		assert.NoError(t, tx.Modify(dbi, &k, func([]byte, bool) ([]byte, bool, error) {
+			return nil, false, nil
+		}))
+		v, e = ttlGet(tx, dbi, "a")
+		assert.Equal(t, ErrSuccess, e)
+		assert.Empty(t, v)
+
+		// counters
+		c := bytesVal([]byte("counter"))
+		n, err := tx.Incr(dbi, &c, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+		n, err = tx.Incr(dbi, &c, -7)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-2), n)
+		var got Val
+		assert.Equal(t, ErrSuccess, tx.Get(dbi, &c, &got))
+		assert.Equal(t, int64(-2), got.I64())
+		k = bytesVal([]byte("text"))
+		assert.Equal(t, ErrSuccess, indexPut(tx, dbi, "text", "abc"))
+		_, err = tx.Incr(dbi, &k, 1)
+		assert.ErrorIs(t, err, ErrNotCounter)
+
+		// compare and swap
+		k = bytesVal([]byte("cas"))
+		ok, err := tx.CAS(dbi, &k, []byte("x"), []byte("1"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = tx.CAS(dbi, &k, nil, []byte("1"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = tx.CAS(dbi, &k, nil, []byte("2"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = tx.CAS(dbi, &k, []byte("1"), []byte("2"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = tx.CAS(dbi, &k, []byte("2"), nil)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		_, e = ttlGet(tx, dbi, "cas")
+		assert.Equal(t, ErrNotFound, e)
+
+		// append
+		k = bytesVal([]byte("log"))
+		assert.NoError(t, tx.Append(dbi, &k, []byte("a")))
+		assert.NoError(t, tx.Append(dbi, &k, []byte("bc")))
+		v, _ = ttlGet(tx, dbi, "log")
+		assert.Equal(t, "abc", v)
+
+		// a key of a DBDupSort table must have a single value
+		k = bytesVal([]byte("k"))
+		assert.NoError(t, tx.Append(multi, &k, []byte("1")))
+		assert.NoError(t, tx.Append(multi, &k, []byte("2")))
+		assert.Equal(t, ErrSuccess, indexPut(tx, multi, "k", "3"))
+		assert.ErrorIs(t, tx.Append(multi, &k, []byte("4")), ErrEMultiVal)
+		return nil
+	})
+	assert.NoError(t, err)
+	keys, values := loaderContents(t, db, multi)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, [][]byte{[]byte("12"), []byte("3")}, values)
+}
+
+func TestModifyHooks(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	assert.NoError(t, db.EnableTTL("modify_ttl"))
+	dbi := openLoaderDBI(t, db, "modify_ttl", DBCreate)
+
+	assert.NoError(t, db.update(func(tx *Tx) error {
+		if e := ttlPut(tx, dbi, "a", "old", time.Millisecond); e != ErrSuccess {
+			return e
+		}
+		return nil
+	}))
+	time.Sleep(5 * time.Millisecond)
+	err = db.update(func(tx *Tx) error {
+		// the expired pair is overwritten, and its deadline cleared by the hook
+		k := bytesVal([]byte("a"))
+		n, err := tx.Incr(dbi, &k, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		deadline, e := tx.Expiry(dbi, &k)
+		assert.Equal(t, ErrSuccess, e)
+		assert.True(t, deadline.IsZero())
+		return nil
+	})
+	assert.NoError(t, err)
+}
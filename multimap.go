@@ -0,0 +1,157 @@
+package gmdbx
+
+import (
+	"iter"
+)
+
+// MultiMap view of a DBDupSort table inside a transaction, each key maps to a
+// sorted set of values ordered by the comparator of the table, so DBReverseDup
+// and DBIntegerGroup are honoured.
+//
+// Slices produced by the iterators point into the database and are only valid
+// until the transaction ends or the table is modified, copy them to keep them.
+// An error stopping an iterator early is reported by Err.
+type MultiMap struct {
+	tx  *Tx
+	dbi DBI
+	err error
+}
+
+// MultiMap return a multimap view of the DBDupSort table dbi
+func (tx *Tx) MultiMap(dbi DBI) *MultiMap {
+	return &MultiMap{tx: tx, dbi: dbi}
+}
+
+// Err return the error which stopped the last iteration, if any
+func (m *MultiMap) Err() error {
+	return m.err
+}
+
+// Put add value to the set of key, adding an existing value is a no-op
+func (m *MultiMap) Put(key, value []byte) error {
+	k, v := bytesVal(key), bytesVal(value)
+	err := m.tx.Put(m.dbi, &k, &v, PutNoDupData)
+	if err != ErrSuccess && err != ErrKeyExist {
+		return err
+	}
+	return nil
+}
+
+// Values iterate over the values of key in order
+func (m *MultiMap) Values(key []byte) iter.Seq[[]byte] {
+	return m.ValuesRange(key, nil, nil)
+}
+
+// ValuesRange iterate over the values of key from the first one greater than
+// or equal to from, up to but not including to. A nil bound is open.
+func (m *MultiMap) ValuesRange(key, from, to []byte) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		m.err = nil
+		cur, err := m.tx.OpenCursor(m.dbi)
+		if err != ErrSuccess {
+			m.err = err
+			return
+		}
+		defer cur.Close()
+
+		k, v := bytesVal(key), Val{}
+		if from != nil {
+			v = bytesVal(from)
+			err = cur.Get(&k, &v, CursorGetBothRange)
+		} else {
+			err = cur.Get(&k, &v, CursorSet)
+		}
+		end := bytesVal(to)
+		for err == ErrSuccess {
+			if to != nil && m.tx.DCmp(m.dbi, &v, &end) >= 0 {
+				return
+			}
+			if !yield(v.UnsafeBytes()) {
+				return
+			}
+			err = cur.Get(&k, &v, CursorNextDup)
+		}
+		if err != ErrNotFound {
+			m.err = err
+		}
+	}
+}
+
+// Has report whether value is in the set of key
+func (m *MultiMap) Has(key, value []byte) (bool, error) {
+	cur, err := m.tx.OpenCursor(m.dbi)
+	if err != ErrSuccess {
+		return false, err
+	}
+	defer cur.Close()
+
+	k, v := bytesVal(key), bytesVal(value)
+	err = cur.Get(&k, &v, CursorGetBoth)
+	switch err {
+	case ErrSuccess:
+		return true, nil
+	case ErrNotFound:
+		return false, nil
+	}
+	return false, err
+}
+
+// CountValues return the number of values of key, 0 if key does not exist
+func (m *MultiMap) CountValues(key []byte) (int, error) {
+	k, v := bytesVal(key), Val{}
+	n, err := m.tx.GetEx(m.dbi, &k, &v)
+	switch err {
+	case ErrSuccess:
+		return n, nil
+	case ErrNotFound:
+		return 0, nil
+	}
+	return 0, err
+}
+
+// FirstValue return a copy of the smallest value of key, ErrNotFound if key
+// does not exist.
+func (m *MultiMap) FirstValue(key []byte) ([]byte, error) {
+	return m.edgeValue(key, CursorFirstDup)
+}
+
+// LastValue return a copy of the largest value of key, ErrNotFound if key
+// does not exist.
+func (m *MultiMap) LastValue(key []byte) ([]byte, error) {
+	return m.edgeValue(key, CursorLastDup)
+}
+
+func (m *MultiMap) edgeValue(key []byte, op CursorOp) ([]byte, error) {
+	cur, err := m.tx.OpenCursor(m.dbi)
+	if err != ErrSuccess {
+		return nil, err
+	}
+	defer cur.Close()
+
+	k, v := bytesVal(key), Val{}
+	if err = cur.Get(&k, &v, CursorSet); err != ErrSuccess {
+		return nil, err
+	}
+	if err = cur.Get(&k, &v, op); err != ErrSuccess {
+		return nil, err
+	}
+	return v.Bytes(), nil
+}
+
+// DeleteValue remove value from the set of key, ErrNotFound if it is absent
+func (m *MultiMap) DeleteValue(key, value []byte) error {
+	k, v := bytesVal(key), bytesVal(value)
+	if err := m.tx.Delete(m.dbi, &k, &v); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+// DeleteAll remove key with all its values, ErrNotFound if it is absent
+func (m *MultiMap) DeleteAll(key []byte) error {
+	k := bytesVal(key)
+	if err := m.tx.Delete(m.dbi, &k, nil); err != ErrSuccess {
+		return err
+	}
+	return nil
+}
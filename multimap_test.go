@@ -0,0 +1,112 @@
+package gmdbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectValues(seq func(func([]byte) bool)) []string {
+	var out []string
+	for v := range seq {
+		out = append(out, string(v))
+	}
+	return out
+}
+
+func TestMultiMap(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *Tx) error {
+		dbi, e := tx.OpenDBI("multimap", DBCreate|DBDupSort)
+		if e != ErrSuccess {
+			return e
+		}
+		m := tx.MultiMap(dbi)
+		for _, v := range []string{"c", "a", "d", "b", "a"} {
+			if err := m.Put([]byte("k1"), []byte(v)); err != nil {
+				return err
+			}
+		}
+		if err := m.Put([]byte("k2"), []byte("z")); err != nil {
+			return err
+		}
+
+		assert.Equal(t, []string{"a", "b", "c", "d"}, collectValues(m.Values([]byte("k1"))))
+		assert.NoError(t, m.Err())
+		assert.Equal(t, []string{"b", "c"}, collectValues(m.ValuesRange([]byte("k1"), []byte("ab"), []byte("d"))))
+		assert.Equal(t, []string{"c", "d"}, collectValues(m.ValuesRange([]byte("k1"), []byte("c"), nil)))
+		assert.Nil(t, collectValues(m.Values([]byte("missing"))))
+		assert.NoError(t, m.Err())
+
+		n, err := m.CountValues([]byte("k1"))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		n, err = m.CountValues([]byte("missing"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		ok, err := m.Has([]byte("k1"), []byte("c"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = m.Has([]byte("k1"), []byte("z"))
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		first, err := m.FirstValue([]byte("k1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a", string(first))
+		last, err := m.LastValue([]byte("k1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "d", string(last))
+		_, err = m.FirstValue([]byte("missing"))
+		assert.Equal(t, ErrNotFound, err)
+
+		assert.NoError(t, m.DeleteValue([]byte("k1"), []byte("b")))
+		assert.Equal(t, ErrNotFound, m.DeleteValue([]byte("k1"), []byte("b")))
+		assert.Equal(t, []string{"a", "c", "d"}, collectValues(m.Values([]byte("k1"))))
+
+		assert.NoError(t, m.DeleteAll([]byte("k1")))
+		assert.Nil(t, collectValues(m.Values([]byte("k1"))))
+		assert.Equal(t, []string{"z"}, collectValues(m.Values([]byte("k2"))))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestMultiMapReverseDup(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *Tx) error {
+		dbi, e := tx.OpenDBI("reverse", DBCreate|DBDupSort|DBReverseDup)
+		if e != ErrSuccess {
+			return e
+		}
+		m := tx.MultiMap(dbi)
+		// values are compared from their last byte to the first one
+		for _, v := range []string{"ab", "ba", "ca", "ac"} {
+			if err := m.Put([]byte("k"), []byte(v)); err != nil {
+				return err
+			}
+		}
+		assert.Equal(t, []string{"ba", "ca", "ab", "ac"}, collectValues(m.Values([]byte("k"))))
+		assert.Equal(t, []string{"ca", "ab"}, collectValues(m.ValuesRange([]byte("k"), []byte("ca"), []byte("ac"))))
+
+		first, err := m.FirstValue([]byte("k"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ba", string(first))
+		last, err := m.LastValue([]byte("k"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ac", string(last))
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -1,5 +1,7 @@
 package gmdbx
 
+import "time"
+
 type Option struct {
 	// Database save path
 	Path       string
@@ -7,6 +9,13 @@ type Option struct {
 	Geometry   Geometry
 	MaxDBS     uint16
 	TxnDpLimit uint16
+
+	// MaxBatchSize maximum number of calls coalesced by DB.Batch,
+	// 0 disables batching.
+	MaxBatchSize int
+	// MaxBatchDelay how long DB.Batch waits for more calls before
+	// committing, 0 disables batching.
+	MaxBatchDelay time.Duration
 }
 
 const (
@@ -30,5 +39,8 @@ var (
 		Geometry:   DefaultGeometry,
 		MaxDBS:     1024,
 		TxnDpLimit: 1024,
+
+		MaxBatchSize:  1000,
+		MaxBatchDelay: 10 * time.Millisecond,
 	}
 )
@@ -0,0 +1,288 @@
+package gmdbx
+
+//#include "mdbxgo.h"
+import "C"
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/sunvim/gmdbx/unsafecgo"
+)
+
+var ErrPoolClosed = errors.New("read pool closed")
+
+// ReadPoolStats counters of a ReadPool
+type ReadPoolStats struct {
+	Hits    uint64 // checkouts served by renewing a pooled transaction
+	Misses  uint64 // checkouts which had to begin a new transaction
+	Expired uint64 // pooled transactions aborted because of max age
+	Idle    int    // reset transactions currently kept by the pool
+}
+
+// ReadPool keeps reset read-only transactions and renews them on checkout,
+// which saves the allocation and reader slot setup done by Env.Begin.
+//
+// Unless the environment is opened with EnvNoTLS a read transaction must be
+// used by the OS thread which renewed it, so the pool keeps idle transactions
+// per OS thread and locks the calling goroutine to its thread between Get and
+// Put.
+//
+// An idle transaction keeps its reader slot, maxAge limits how long a handle
+// is reused before it is aborted and the slot released. Expired handles are
+// swept by a background goroutine, so checkouts never read the clock.
+type ReadPool struct {
+	env       *Env
+	maxAge    time.Duration
+	perThread bool
+
+	mu     sync.Mutex
+	idle   map[uint64][]*Tx
+	closed bool
+	done   chan struct{}
+
+	hits    uint64
+	misses  uint64
+	expired uint64
+}
+
+// NewReadPool create a pool of read-only transactions, maxAge of zero means
+// pooled transactions never expire.
+func NewReadPool(env *Env, maxAge time.Duration) *ReadPool {
+	p := &ReadPool{
+		env:    env,
+		maxAge: maxAge,
+		idle:   make(map[uint64][]*Tx),
+		done:   make(chan struct{}),
+	}
+	flags, err := env.GetFlags()
+	p.perThread = err != ErrSuccess || flags&EnvNoTLS == 0
+	if maxAge > 0 {
+		go p.sweep()
+	}
+	env.registerPool(p)
+	return p
+}
+
+// NewReadPool create a pool of read-only transactions for the database
+func (d *DB) NewReadPool(maxAge time.Duration) *ReadPool {
+	return NewReadPool(d.env, maxAge)
+}
+
+func threadID() uint64 {
+	args := struct {
+		id uintptr
+	}{}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_thread_id), ptr, 0)
+	return uint64(args.id)
+}
+
+// Get check out a running read-only transaction, it must be given back by Put
+// from the same goroutine.
+func (p *ReadPool) Get() (*Tx, error) {
+	var key uint64
+	if p.perThread {
+		runtime.LockOSThread()
+		key = threadID()
+	}
+
+	// counted by the compaction gate before an idle transaction is taken,
+	// Compact aborts the idle ones before closing the environment
+	gated := p.env.enter(false)
+	for {
+		tx, closed := p.pop(key)
+		if closed {
+			p.env.leaveReader()
+			if p.perThread {
+				runtime.UnlockOSThread()
+			}
+			return nil, ErrPoolClosed
+		}
+		if tx == nil {
+			break
+		}
+		if err := tx.renewRaw(); err != ErrSuccess {
+			tx.Abort()
+			continue
+		}
+		tx.gated = gated
+		atomic.AddUint64(&p.hits, 1)
+		return tx, nil
+	}
+
+	atomic.AddUint64(&p.misses, 1)
+	tx := NewTransaction(p.env)
+	if err := p.env.begin(tx, TxReadOnly); err != ErrSuccess {
+		p.env.leaveReader()
+		if p.perThread {
+			runtime.UnlockOSThread()
+		}
+		return nil, err
+	}
+	tx.gated = gated
+	tx.born = time.Now().UnixNano()
+	return tx, nil
+}
+
+// Put reset the transaction and give it back to the pool
+func (p *ReadPool) Put(tx *Tx) {
+	if p.perThread {
+		defer runtime.UnlockOSThread()
+	}
+	if tx.IsAborted() || tx.IsCommitted() {
+		return
+	}
+	// cursors left open by the caller are reported and forgotten, its user
+	// data released, so the next one does not inherit them
+	tx.untrackCursors()
+	if tx.userData != 0 && tx.SetUserData(nil) != ErrSuccess {
+		tx.Abort()
+		return
+	}
+	if err := tx.resetRaw(); err != ErrSuccess {
+		tx.Abort()
+		return
+	}
+	// out of the compaction gate before Get can take it again
+	tx.leave()
+
+	var key uint64
+	if p.perThread {
+		key = threadID()
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		tx.Abort()
+		return
+	}
+	p.idle[key] = append(p.idle[key], tx)
+	p.mu.Unlock()
+}
+
+func (p *ReadPool) pop(key uint64) (*Tx, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, true
+	}
+	txs := p.idle[key]
+	if len(txs) == 0 {
+		return nil, false
+	}
+	tx := txs[len(txs)-1]
+	txs[len(txs)-1] = nil
+	p.idle[key] = txs[:len(txs)-1]
+	return tx, false
+}
+
+func (p *ReadPool) sweep() {
+	interval := p.maxAge / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var expired []*Tx
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			deadline := now.Add(-p.maxAge).UnixNano()
+			p.env.enter(false)
+			p.mu.Lock()
+			for key, txs := range p.idle {
+				kept := txs[:0]
+				for _, tx := range txs {
+					if tx.born < deadline {
+						expired = append(expired, tx)
+					} else {
+						kept = append(kept, tx)
+					}
+				}
+				clear(txs[len(kept):])
+				p.idle[key] = kept
+			}
+			p.mu.Unlock()
+
+			// reset transactions are not owned by a thread and may be
+			// aborted from here
+			for i, tx := range expired {
+				tx.Abort()
+				expired[i] = nil
+			}
+			p.env.leaveReader()
+			atomic.AddUint64(&p.expired, uint64(len(expired)))
+			expired = expired[:0]
+		}
+	}
+}
+
+// View run fn inside a pooled read-only transaction
+func (p *ReadPool) View(fn func(tx *Tx) error) error {
+	tx, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer p.Put(tx)
+
+	return fn(tx)
+}
+
+// Stats return the pool counters
+func (p *ReadPool) Stats() ReadPoolStats {
+	st := ReadPoolStats{
+		Hits:    atomic.LoadUint64(&p.hits),
+		Misses:  atomic.LoadUint64(&p.misses),
+		Expired: atomic.LoadUint64(&p.expired),
+	}
+	p.mu.Lock()
+	for _, txs := range p.idle {
+		st.Idle += len(txs)
+	}
+	p.mu.Unlock()
+	return st
+}
+
+// Close abort all idle transactions, transactions given back later are
+// aborted by Put.
+func (p *ReadPool) Close() error {
+	p.env.enter(false)
+	defer p.env.leaveReader()
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = make(map[uint64][]*Tx)
+	if !p.closed {
+		close(p.done)
+		p.env.unregisterPool(p)
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	abortIdle(idle)
+	return nil
+}
+
+// dropIdle abort the idle transactions, called by Compact while no
+// transaction runs
+func (p *ReadPool) dropIdle() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = make(map[uint64][]*Tx)
+	p.mu.Unlock()
+	abortIdle(idle)
+}
+
+func abortIdle(idle map[uint64][]*Tx) {
+	for _, txs := range idle {
+		for _, tx := range txs {
+			tx.Abort()
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package gmdbx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPool(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	key := []byte("hello")
+	val := []byte("world")
+
+	var dbi DBI
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		dbi, e = tx.OpenDBI("pool", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		ki, vi := Bytes(&key), Bytes(&val)
+		if e = tx.Put(dbi, &ki, &vi, PutUpsert); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := db.NewReadPool(time.Minute)
+	for i := 0; i < 10; i++ {
+		err = pool.View(func(tx *Tx) error {
+			ki, vi := Bytes(&key), Val{}
+			if e := tx.Get(dbi, &ki, &vi); e != ErrSuccess {
+				return e
+			}
+			assert.Equal(t, val, vi.Bytes())
+			return nil
+		})
+		if err != nil {
+			t.Fatal("pooled view failed: ", err)
+		}
+	}
+
+	st := pool.Stats()
+	assert.Equal(t, uint64(10), st.Hits+st.Misses)
+	assert.True(t, st.Hits >= 1, "pooled transactions should be reused")
+
+	pool.Close()
+	assert.Equal(t, 0, pool.Stats().Idle)
+	_, err = pool.Get()
+	assert.True(t, errors.Is(err, ErrPoolClosed))
+}
+
+func TestReadPoolMaxAge(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	pool := db.NewReadPool(time.Millisecond)
+	defer pool.Close()
+
+	tx, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(tx)
+	assert.Equal(t, 1, pool.Stats().Idle)
+
+	time.Sleep(20 * time.Millisecond)
+
+	st := pool.Stats()
+	assert.Equal(t, uint64(1), st.Expired, "expired transaction should be aborted")
+	assert.Equal(t, 0, st.Idle)
+}
+
+func BenchmarkDBView(b *testing.B) {
+	db, err := newTestDb()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.View(func(tx *Tx) error {
+			return nil
+		})
+	}
+}
+
+func TestReadPoolGate(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	// a transaction taken back by Get while it is put must stay counted
+	pool := db.NewReadPool(time.Minute)
+	defer pool.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				pool.View(func(tx *Tx) error {
+					assert.Positive(t, db.env.readers.Load())
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, db.env.readers.Load())
+}
+
+func BenchmarkReadPoolView(b *testing.B) {
+	db, err := newTestDb()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	pool := db.NewReadPool(time.Second)
+	defer pool.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.View(func(tx *Tx) error {
+			return nil
+		})
+	}
+}
+
+func TestReadPoolPutReleases(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	dbi := openLoaderDBI(t, db, "pool", DBCreate)
+	pool := db.NewReadPool(time.Minute)
+	defer pool.Close()
+
+	// a cursor left open and user data are released when put back
+	var (
+		first *Tx
+		cur   *Cursor
+	)
+	err = pool.View(func(tx *Tx) error {
+		first = tx
+		var e Error
+		if cur, e = tx.OpenCursor(dbi); e != ErrSuccess {
+			return e
+		}
+		if e := tx.SetUserData("first"); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, first.cursors)
+	cur.Close()
+
+	err = pool.View(func(tx *Tx) error {
+		assert.Same(t, first, tx)
+		assert.Nil(t, tx.UserData())
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,274 @@
+package replication
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/sunvim/gmdbx"
+)
+
+// FollowerOptions configuration of a Follower
+type FollowerOptions struct {
+	// Resync accept a full snapshot when the follower diverged from the
+	// leader, instead of stopping with ErrDiverged.
+	Resync bool
+	// RetryInterval delay between reconnections of Run, default 1s.
+	RetryInterval time.Duration
+}
+
+// FollowerStats counters of a Follower
+type FollowerStats struct {
+	Snapshots uint64 // snapshots received
+	Txns      uint64 // source transactions applied
+}
+
+// Follower applies the stream of a leader to a local database, which should
+// only be written by the follower.
+type Follower struct {
+	db   *gmdbx.DB
+	opts FollowerOptions
+
+	applied   atomic.Uint64
+	leaderID  atomic.Uint64
+	snapshots atomic.Uint64
+	txns      atomic.Uint64
+}
+
+// NewFollower load the replication state of db from its canary
+func NewFollower(db *gmdbx.DB, opts FollowerOptions) (*Follower, error) {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	f := &Follower{db: db, opts: opts}
+	err := db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		var c gmdbx.Canary
+		if err := tx.GetCanary(&c); err != gmdbx.ErrSuccess {
+			return err
+		}
+		f.applied.Store(c.X)
+		f.leaderID.Store(c.Y)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Applied return the ID of the last leader transaction applied
+func (f *Follower) Applied() uint64 {
+	return f.applied.Load()
+}
+
+// LeaderID return the identity of the followed leader, 0 before the first
+// complete snapshot.
+func (f *Follower) LeaderID() uint64 {
+	return f.leaderID.Load()
+}
+
+// Stats return the follower counters
+func (f *Follower) Stats() FollowerStats {
+	return FollowerStats{Snapshots: f.snapshots.Load(), Txns: f.txns.Load()}
+}
+
+// Run follow the leader reached by dial, reconnecting after failures, until
+// ctx is done or the follower diverged.
+func (f *Follower) Run(ctx context.Context, dial func(ctx context.Context) (net.Conn, error)) error {
+	for {
+		conn, err := dial(ctx)
+		if err == nil {
+			err = f.Sync(ctx, conn)
+		}
+		if errors.Is(err, ErrDiverged) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.opts.RetryInterval):
+		}
+	}
+}
+
+// Sync follow the leader over conn until the connection fails or ctx is done
+func (f *Follower) Sync(ctx context.Context, conn net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+	err := enc.Encode(message{
+		Kind:     msgHello,
+		LeaderID: f.leaderID.Load(),
+		TxnID:    f.applied.Load(),
+		Resync:   f.opts.Resync,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		var msg message
+		if err = dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		switch msg.Kind {
+		case msgDiverged:
+			return ErrDiverged
+		case msgSnapshot:
+			err = f.update(ctx, func(tx *gmdbx.Tx) error {
+				return f.applySnapshot(tx, dec, msg)
+			})
+			if err == nil {
+				f.leaderID.Store(msg.LeaderID)
+				f.applied.Store(msg.TxnID)
+				f.snapshots.Add(1)
+			}
+		case msgTxn:
+			if msg.TxnID <= f.applied.Load() {
+				continue
+			}
+			err = f.update(ctx, func(tx *gmdbx.Tx) error {
+				if err := f.applyRecords(tx, msg.Records); err != nil {
+					return err
+				}
+				return f.setApplied(tx, msg.TxnID, f.leaderID.Load())
+			})
+			if err == nil {
+				f.applied.Store(msg.TxnID)
+				f.txns.Add(1)
+			}
+		default:
+			return ErrProtocol
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+func (f *Follower) update(ctx context.Context, fn func(tx *gmdbx.Tx) error) error {
+	return f.db.UpdateContext(ctx, fn)
+}
+
+func (f *Follower) setApplied(tx *gmdbx.Tx, txnID, leaderID uint64) error {
+	var c gmdbx.Canary
+	if err := tx.GetCanary(&c); err != gmdbx.ErrSuccess {
+		return err
+	}
+	c.X, c.Y = txnID, leaderID
+	if err := tx.PutCanary(&c); err != gmdbx.ErrSuccess {
+		return err
+	}
+	return nil
+}
+
+// applySnapshot replace the tables by the pairs of the snapshot read from
+// dec, up to its end, so an interrupted snapshot leaves the tables as they
+// were.
+func (f *Follower) applySnapshot(tx *gmdbx.Tx, dec *gob.Decoder, snapshot message) error {
+	dbis := tables{}
+	for _, name := range snapshot.Tables {
+		dbi, err := dbis.open(tx, name)
+		if err != nil {
+			return err
+		}
+		if e := tx.Drop(dbi, false); e != gmdbx.ErrSuccess {
+			return e
+		}
+	}
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		switch msg.Kind {
+		case msgPairs:
+			if err := f.putPairs(tx, dbis, msg.Pairs); err != nil {
+				return err
+			}
+		case msgSnapshotEnd:
+			if msg.TxnID != snapshot.TxnID {
+				return ErrProtocol
+			}
+			return f.setApplied(tx, snapshot.TxnID, snapshot.LeaderID)
+		default:
+			return ErrProtocol
+		}
+	}
+}
+
+// tables cache of the handles opened during a follower transaction
+type tables map[string]gmdbx.DBI
+
+func (t tables) open(tx *gmdbx.Tx, name string) (gmdbx.DBI, error) {
+	if dbi, ok := t[name]; ok {
+		return dbi, nil
+	}
+	dbi, err := tx.OpenDBI(name, gmdbx.DBCreate)
+	if err != gmdbx.ErrSuccess {
+		return 0, err
+	}
+	t[name] = dbi
+	return dbi, nil
+}
+
+func (f *Follower) putPairs(tx *gmdbx.Tx, dbis tables, pairs []pair) error {
+	for i := range pairs {
+		p := &pairs[i]
+		dbi, err := dbis.open(tx, p.Table)
+		if err != nil {
+			return err
+		}
+		k, v := val(p.Key), val(p.Value)
+		if e := tx.Put(dbi, &k, &v, gmdbx.PutUpsert); e != gmdbx.ErrSuccess {
+			return e
+		}
+	}
+	return nil
+}
+
+func (f *Follower) applyRecords(tx *gmdbx.Tx, records []record) error {
+	dbis := tables{}
+	for i := range records {
+		r := &records[i]
+		dbi, err := dbis.open(tx, r.Table)
+		if err != nil {
+			return err
+		}
+		var e gmdbx.Error
+		switch r.Op {
+		case gmdbx.ChangePut:
+			k, v := val(r.Key), val(r.Value)
+			e = tx.Put(dbi, &k, &v, gmdbx.PutUpsert)
+		case gmdbx.ChangeDelete:
+			k := val(r.Key)
+			if e = tx.Delete(dbi, &k, nil); e == gmdbx.ErrNotFound {
+				e = gmdbx.ErrSuccess
+			}
+		case gmdbx.ChangeDrop:
+			e = tx.Drop(dbi, false)
+		default:
+			return ErrProtocol
+		}
+		if e != gmdbx.ErrSuccess {
+			return e
+		}
+	}
+	return nil
+}
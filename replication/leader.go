@@ -0,0 +1,267 @@
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"net"
+
+	"github.com/sunvim/gmdbx"
+)
+
+// LeaderTable table of the leader holding its identity
+const LeaderTable = "__replication"
+
+var leaderIDKey = []byte("leader_id")
+
+// LeaderOptions configuration of a Leader
+type LeaderOptions struct {
+	// SnapshotBatch pairs sent per snapshot message, default 1000.
+	SnapshotBatch int
+}
+
+// Leader serves the tables of a changelog to followers
+type Leader struct {
+	db   *gmdbx.DB
+	cl   *gmdbx.Changelog
+	id   uint64
+	opts LeaderOptions
+}
+
+// NewLeader serve the tables recorded by cl, the identity of the leader is
+// created on first use and kept in LeaderTable.
+func NewLeader(db *gmdbx.DB, cl *gmdbx.Changelog, opts LeaderOptions) (*Leader, error) {
+	if opts.SnapshotBatch <= 0 {
+		opts.SnapshotBatch = 1000
+	}
+	l := &Leader{db: db, cl: cl, opts: opts}
+	err := db.UpdateContext(context.Background(), func(tx *gmdbx.Tx) error {
+		dbi, err := tx.OpenDBI(LeaderTable, gmdbx.DBCreate)
+		if err != gmdbx.ErrSuccess {
+			return err
+		}
+		k, v := gmdbx.Bytes(&leaderIDKey), gmdbx.Val{}
+		switch err = tx.Get(dbi, &k, &v); err {
+		case gmdbx.ErrSuccess:
+			b := v.Bytes()
+			if len(b) != 8 {
+				return ErrProtocol
+			}
+			l.id = binary.BigEndian.Uint64(b)
+			return nil
+		case gmdbx.ErrNotFound:
+		default:
+			return err
+		}
+
+		var b [8]byte
+		for l.id == 0 {
+			if _, err := rand.Read(b[:]); err != nil {
+				return err
+			}
+			l.id = binary.BigEndian.Uint64(b[:])
+		}
+		id := b[:]
+		v = gmdbx.Bytes(&id)
+		if err = tx.Put(dbi, &k, &v, gmdbx.PutUpsert); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ID return the identity of the leader
+func (l *Leader) ID() uint64 {
+	return l.id
+}
+
+// Serve accept followers on ln until ctx is done, then close ln
+func (l *Leader) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go l.ServeConn(ctx, conn)
+	}
+}
+
+// ServeConn serve one follower until the connection fails or ctx is done
+func (l *Leader) ServeConn(ctx context.Context, conn net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	var hello message
+	if err := dec.Decode(&hello); err != nil {
+		return err
+	}
+	if hello.Kind != msgHello {
+		return ErrProtocol
+	}
+	// the follower sends nothing else, a failed read means it is gone
+	go func() {
+		var m message
+		dec.Decode(&m)
+		cancel()
+	}()
+
+	from, snapshot, err := l.plan(hello)
+	if errors.Is(err, ErrDiverged) && hello.Resync {
+		snapshot, err = true, nil
+	}
+	if err != nil {
+		if errors.Is(err, ErrDiverged) {
+			enc.Encode(message{Kind: msgDiverged, LeaderID: l.id})
+		}
+		return err
+	}
+	if snapshot {
+		if from, err = l.sendSnapshot(ctx, enc); err != nil {
+			return err
+		}
+	}
+	return l.stream(ctx, enc, from)
+}
+
+// plan decide how a follower catches up: from the changelog after its
+// applied transaction, or with a snapshot.
+func (l *Leader) plan(hello message) (uint64, bool, error) {
+	if hello.LeaderID == 0 {
+		// never synced, or interrupted during a snapshot
+		return 0, true, nil
+	}
+	if hello.LeaderID != l.id {
+		return 0, false, ErrDiverged
+	}
+
+	var last uint64
+	err := l.db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		last = tx.ID()
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if hello.TxnID > last {
+		return 0, false, ErrDiverged
+	}
+	truncated, err := l.cl.Truncated()
+	if err != nil {
+		return 0, false, err
+	}
+	if truncated > hello.TxnID {
+		return 0, true, nil
+	}
+	return hello.TxnID + 1, false, nil
+}
+
+// sendSnapshot send all pairs of the tables as of one read-only transaction,
+// whose ID is returned.
+func (l *Leader) sendSnapshot(ctx context.Context, enc *gob.Encoder) (uint64, error) {
+	var snapshot uint64
+	tables := l.cl.Tables()
+	err := l.db.ViewContext(ctx, func(tx *gmdbx.Tx) error {
+		snapshot = tx.ID()
+		err := enc.Encode(message{Kind: msgSnapshot, LeaderID: l.id, TxnID: snapshot, Tables: tables})
+		if err != nil {
+			return err
+		}
+
+		batch := message{Kind: msgPairs}
+		for _, name := range tables {
+			dbi, e := tx.OpenDBI(name, 0)
+			if e == gmdbx.ErrNotFound {
+				continue
+			}
+			if e != gmdbx.ErrSuccess {
+				return e
+			}
+			err = tx.ForEach(dbi, func(k, v []byte) error {
+				batch.Pairs = append(batch.Pairs, pair{
+					Table: name,
+					Key:   append([]byte{}, k...),
+					Value: append([]byte{}, v...),
+				})
+				if len(batch.Pairs) < l.opts.SnapshotBatch {
+					return nil
+				}
+				err := enc.Encode(batch)
+				batch.Pairs = batch.Pairs[:0]
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(batch.Pairs) > 0 {
+			if err = enc.Encode(batch); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(message{Kind: msgSnapshotEnd, TxnID: snapshot})
+	})
+	return snapshot + 1, err
+}
+
+// stream send the changelog from transaction from on, one message per
+// source transaction.
+func (l *Leader) stream(ctx context.Context, enc *gob.Encoder, from uint64) error {
+	r, err := l.cl.NewReader("", from)
+	if err != nil {
+		return err
+	}
+	// the records of a transaction are committed together, once a poll
+	// finds nothing more the transaction is complete
+	poll, stop := context.WithCancel(ctx)
+	stop()
+
+	var next *gmdbx.ChangelogRecord
+	for {
+		if next == nil {
+			rec, err := r.Next(ctx)
+			if err != nil {
+				return err
+			}
+			next = &rec
+		}
+		msg := message{Kind: msgTxn, TxnID: next.TxnID}
+		for next != nil && next.TxnID == msg.TxnID {
+			msg.Records = append(msg.Records, record{Table: next.Table, Op: next.Op, Key: next.Key, Value: next.New})
+			rec, err := r.Next(poll)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if !errors.Is(err, context.Canceled) {
+					return err
+				}
+				next = nil
+				break
+			}
+			next = &rec
+		}
+		if err = enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package replication keeps read replicas of a gmdbx database over any
+// net.Conn.
+//
+// The leader records the writes of the replicated tables with a
+// gmdbx.Changelog. A follower connecting for the first time receives a
+// consistent snapshot of those tables, read in a single read-only
+// transaction and applied in a single follower transaction, then the
+// changelog records of every transaction committed after it. Each source transaction is applied in one follower transaction,
+// which also stores the applied leader transaction ID in Canary.X and the
+// leader identity in Canary.Y, so a restarted follower resumes where it
+// stopped. Canary.Z is left untouched.
+//
+// A follower which applied transactions the leader does not have, or which
+// followed another leader, has diverged: it is refused with ErrDiverged unless
+// it accepts a full resync. A follower missing records removed by
+// Changelog.Truncate is resynced with a new snapshot.
+//
+// Tables with DBDupSort are not supported.
+package replication
+
+import (
+	"errors"
+
+	"github.com/sunvim/gmdbx"
+)
+
+var (
+	ErrDiverged = errors.New("replication: follower diverged from leader")
+	ErrProtocol = errors.New("replication: protocol error")
+)
+
+type msgKind uint8
+
+const (
+	msgHello msgKind = iota + 1
+	msgSnapshot
+	msgPairs
+	msgSnapshotEnd
+	msgTxn
+	msgDiverged
+)
+
+// message unit exchanged with encoding/gob, the follower sends a single
+// hello, the leader answers with a stream of the other kinds.
+type message struct {
+	Kind     msgKind
+	LeaderID uint64
+	// TxnID applied transaction of a hello, snapshot transaction of a
+	// snapshot, source transaction of a txn.
+	TxnID   uint64
+	Resync  bool
+	Tables  []string
+	Pairs   []pair
+	Records []record
+}
+
+type pair struct {
+	Table      string
+	Key, Value []byte
+}
+
+type record struct {
+	Table      string
+	Op         gmdbx.ChangeOp
+	Key, Value []byte
+}
+
+// val like gmdbx.Bytes, but an empty value, which gob decodes as nil, gives
+// an empty Val.
+func val(b []byte) gmdbx.Val {
+	if len(b) == 0 {
+		return gmdbx.Val{}
+	}
+	return gmdbx.Bytes(&b)
+}
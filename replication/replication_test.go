@@ -0,0 +1,284 @@
+package replication
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/sunvim/gmdbx"
+)
+
+var testTables = []string{"users", "orders"}
+
+func openDB(t *testing.T) *gmdbx.DB {
+	db, err := gmdbx.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// write run fn on the named tables and return the committed transaction ID
+func write(t *testing.T, db *gmdbx.DB, fn func(tx *gmdbx.Tx, dbis map[string]gmdbx.DBI) error) uint64 {
+	var id uint64
+	err := db.UpdateContext(context.Background(), func(tx *gmdbx.Tx) error {
+		tx.OnCommit(func(txnID uint64) { id = txnID })
+		dbis := map[string]gmdbx.DBI{}
+		for _, name := range testTables {
+			dbi, err := tx.OpenDBI(name, gmdbx.DBCreate)
+			if err != gmdbx.ErrSuccess {
+				return err
+			}
+			dbis[name] = dbi
+		}
+		return fn(tx, dbis)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func put(t *testing.T, db *gmdbx.DB, table, key, value string) uint64 {
+	return write(t, db, func(tx *gmdbx.Tx, dbis map[string]gmdbx.DBI) error {
+		kv, vv := val([]byte(key)), val([]byte(value))
+		if err := tx.Put(dbis[table], &kv, &vv, gmdbx.PutUpsert); err != gmdbx.ErrSuccess {
+			return err
+		}
+		return nil
+	})
+}
+
+func dump(t *testing.T, db *gmdbx.DB) map[string]map[string]string {
+	out := map[string]map[string]string{}
+	err := db.ViewContext(context.Background(), func(tx *gmdbx.Tx) error {
+		for _, name := range testTables {
+			out[name] = map[string]string{}
+			dbi, err := tx.OpenDBI(name, 0)
+			if err == gmdbx.ErrNotFound {
+				continue
+			}
+			if err != gmdbx.ErrSuccess {
+				return err
+			}
+			e := tx.ForEach(dbi, func(k, v []byte) error {
+				out[name][string(k)] = string(v)
+				return nil
+			})
+			if e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return out
+}
+
+// spawn run fn in a goroutine the end of the test waits for, before the
+// databases opened earlier are closed
+func spawn(t *testing.T, fn func()) {
+	done := make(chan struct{})
+	t.Cleanup(func() { <-done })
+	go func() {
+		defer close(done)
+		fn()
+	}()
+}
+
+// pipe dial a leader over net.Pipe, the leader ends of the connections are
+// sent to conns.
+func pipe(t *testing.T, leader *Leader, conns chan<- net.Conn) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		a, b := net.Pipe()
+		if conns != nil {
+			conns <- a
+		}
+		spawn(t, func() { leader.ServeConn(ctx, a) })
+		return b, nil
+	}
+}
+
+func follow(t *testing.T, f *Follower, dial func(ctx context.Context) (net.Conn, error)) (stop func() error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.Run(ctx, dial) }()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+func waitApplied(t *testing.T, f *Follower, txnID uint64) {
+	t.Helper()
+	assert.Eventually(t, func() bool { return f.Applied() >= txnID }, 5*time.Second, time.Millisecond,
+		"applied %d, want %d", f.Applied(), txnID)
+}
+
+func TestReplication(t *testing.T) {
+	leaderDB := openDB(t)
+	cl, err := leaderDB.EnableChangelog(testTables...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"ann", "bob", "cid", "dan", "eve"} {
+		put(t, leaderDB, "users", string(rune('1'+i)), name)
+	}
+	last := put(t, leaderDB, "orders", "o1", "book")
+
+	leader, err := NewLeader(leaderDB, cl, LeaderOptions{SnapshotBatch: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	followerDB := openDB(t)
+	f, err := NewFollower(followerDB, FollowerOptions{RetryInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// initial snapshot
+	conns := make(chan net.Conn, 16)
+	stop := follow(t, f, pipe(t, leader, conns))
+	waitApplied(t, f, last)
+	assert.Equal(t, dump(t, leaderDB), dump(t, followerDB))
+	assert.Equal(t, leader.ID(), f.LeaderID())
+	assert.Equal(t, FollowerStats{Snapshots: 1}, f.Stats())
+
+	// streaming
+	put(t, leaderDB, "users", "6", "")
+	last = write(t, leaderDB, func(tx *gmdbx.Tx, dbis map[string]gmdbx.DBI) error {
+		k := []byte("1")
+		kv := gmdbx.Bytes(&k)
+		tx.Delete(dbis["users"], &kv, nil)
+		tx.Drop(dbis["orders"], false)
+		return nil
+	})
+	waitApplied(t, f, last)
+	assert.Equal(t, dump(t, leaderDB), dump(t, followerDB))
+	assert.Equal(t, FollowerStats{Snapshots: 1, Txns: 2}, f.Stats())
+
+	// reconnect and catch up from the changelog
+	(<-conns).Close()
+	last = put(t, leaderDB, "orders", "o2", "pen")
+	waitApplied(t, f, last)
+	assert.Equal(t, dump(t, leaderDB), dump(t, followerDB))
+	assert.Equal(t, uint64(1), f.Stats().Snapshots)
+	assert.Equal(t, context.Canceled, stop())
+
+	// a restarted follower resumes from its canary
+	put(t, leaderDB, "users", "7", "fay")
+	last = put(t, leaderDB, "users", "8", "gus")
+	f, err = NewFollower(followerDB, FollowerOptions{RetryInterval: 5 * time.Millisecond})
+	assert.NoError(t, err)
+	stop = follow(t, f, pipe(t, leader, nil))
+	waitApplied(t, f, last)
+	assert.Equal(t, dump(t, leaderDB), dump(t, followerDB))
+	assert.Equal(t, FollowerStats{Txns: 2}, f.Stats())
+	stop()
+
+	// records it missed were truncated, it needs a new snapshot
+	put(t, leaderDB, "users", "9", "hal")
+	last = put(t, leaderDB, "users", "10", "ivy")
+	n, err := cl.Truncate(last + 1)
+	assert.NoError(t, err)
+	assert.Positive(t, n)
+	f, err = NewFollower(followerDB, FollowerOptions{RetryInterval: 5 * time.Millisecond})
+	assert.NoError(t, err)
+	stop = follow(t, f, pipe(t, leader, nil))
+	waitApplied(t, f, last)
+	assert.Equal(t, dump(t, leaderDB), dump(t, followerDB))
+	assert.Equal(t, uint64(1), f.Stats().Snapshots)
+	stop()
+}
+
+func TestReplicationDivergence(t *testing.T) {
+	newLeader := func() (*gmdbx.DB, *Leader) {
+		db := openDB(t)
+		cl, err := db.EnableChangelog(testTables...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := NewLeader(db, cl, LeaderOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db, l
+	}
+	firstDB, first := newLeader()
+	last := put(t, firstDB, "users", "1", "ann")
+
+	followerDB := openDB(t)
+	f, err := NewFollower(followerDB, FollowerOptions{RetryInterval: 5 * time.Millisecond})
+	assert.NoError(t, err)
+	stop := follow(t, f, pipe(t, first, nil))
+	waitApplied(t, f, last)
+	stop()
+
+	// another leader, with a different history
+	secondDB, second := newLeader()
+	put(t, secondDB, "orders", "o1", "book")
+	assert.NotEqual(t, first.ID(), second.ID())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Equal(t, ErrDiverged, f.Run(ctx, pipe(t, second, nil)))
+	assert.Equal(t, first.ID(), f.LeaderID())
+
+	// accepting a resync replaces the data
+	f, err = NewFollower(followerDB, FollowerOptions{Resync: true})
+	assert.NoError(t, err)
+	a, b := net.Pipe()
+	spawn(t, func() { second.ServeConn(ctx, a) })
+	spawn(t, func() { f.Sync(ctx, b) })
+	assert.Eventually(t, func() bool { return f.LeaderID() == second.ID() }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, dump(t, secondDB), dump(t, followerDB))
+}
+
+func TestReplicationInterruptedSnapshot(t *testing.T) {
+	leaderDB := openDB(t)
+	cl, err := leaderDB.EnableChangelog(testTables...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := put(t, leaderDB, "users", "1", "ann")
+	leader, err := NewLeader(leaderDB, cl, LeaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	followerDB := openDB(t)
+	f, err := NewFollower(followerDB, FollowerOptions{})
+	assert.NoError(t, err)
+	stop := follow(t, f, pipe(t, leader, nil))
+	waitApplied(t, f, last)
+	stop()
+	before, applied := dump(t, followerDB), f.Applied()
+
+	// a leader failing in the middle of a snapshot
+	a, b := net.Pipe()
+	go func() {
+		defer a.Close()
+		var hello message
+		if gob.NewDecoder(a).Decode(&hello) != nil {
+			return
+		}
+		enc := gob.NewEncoder(a)
+		enc.Encode(message{Kind: msgSnapshot, LeaderID: 99, TxnID: 50, Tables: testTables})
+		enc.Encode(message{Kind: msgPairs, Pairs: []pair{{Table: "users", Key: []byte("2"), Value: []byte("bob")}}})
+	}()
+	assert.Error(t, f.Sync(context.Background(), b))
+
+	// the follower keeps its previous state
+	assert.Equal(t, before, dump(t, followerDB))
+	f, err = NewFollower(followerDB, FollowerOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, applied, f.Applied())
+	assert.Equal(t, leader.ID(), f.LeaderID())
+}
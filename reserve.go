@@ -0,0 +1,43 @@
+package gmdbx
+
+import (
+	"unsafe"
+)
+
+// Reserve store key with a value of size bytes left for the caller to fill,
+// the returned slice is backed by the dirty page of the database, so data can
+// be serialized in place without an intermediate buffer.
+//
+// The slice is only valid until the next operation modifying the transaction,
+// i.e. Put, Delete, Replace, Drop, another Reserve, the write operations of its
+// cursors, Commit or Abort. Writing to it later corrupts the database. Build
+// with the gmdbx_debug tag to have late writes detected, the transaction then
+// panics when it ends.
+func (tx *Tx) Reserve(dbi DBI, key []byte, size int, flags PutFlags) ([]byte, error) {
+	k, v := bytesVal(key), Val{Len: uint64(size)}
+	if err := tx.Put(dbi, &k, &v, flags|PutReserve); err != ErrSuccess {
+		return nil, err
+	}
+	return reserved(uintptr(unsafe.Pointer(tx.txn)), v), nil
+}
+
+// Reserve like Tx.Reserve but stores key through the cursor, which is left
+// positioned on the new pair.
+func (cur *Cursor) Reserve(key []byte, size int, flags PutFlags) ([]byte, error) {
+	k, v := bytesVal(key), Val{Len: uint64(size)}
+	if err := cur.Put(&k, &v, flags|PutReserve); err != ErrSuccess {
+		return nil, err
+	}
+	return reserved(uintptr(unsafe.Pointer(cur.Tx())), v), nil
+}
+
+func reserved(txn uintptr, v Val) []byte {
+	if v.Len == 0 {
+		return []byte{}
+	}
+	page := unsafe.Slice(v.Base, int(v.Len))
+	if debugReserve {
+		return trackReserved(txn, page)
+	}
+	return page
+}
@@ -0,0 +1,66 @@
+//go:build gmdbx_debug
+
+package gmdbx
+
+import (
+	"sync"
+)
+
+// debugReserve hand out shadow buffers instead of the reserved pages, the
+// shadow is copied to the page before the next modification of the
+// transaction and then poisoned, so writes made after the validity window
+// are detected when the transaction ends.
+const debugReserve = true
+
+const reservePoison = 0xdb
+
+type reservation struct {
+	page    []byte
+	shadow  []byte
+	flushed bool
+}
+
+var (
+	reservedMu sync.Mutex
+	reservedBy = make(map[uintptr][]*reservation)
+)
+
+func trackReserved(txn uintptr, page []byte) []byte {
+	r := &reservation{page: page, shadow: make([]byte, len(page))}
+	reservedMu.Lock()
+	reservedBy[txn] = append(reservedBy[txn], r)
+	reservedMu.Unlock()
+	return r.shadow
+}
+
+func flushReserved(txn uintptr) {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+	for _, r := range reservedBy[txn] {
+		if r.flushed {
+			continue
+		}
+		copy(r.page, r.shadow)
+		for i := range r.shadow {
+			r.shadow[i] = reservePoison
+		}
+		r.page = nil
+		r.flushed = true
+	}
+}
+
+func endReserved(txn uintptr) {
+	flushReserved(txn)
+	reservedMu.Lock()
+	rs := reservedBy[txn]
+	delete(reservedBy, txn)
+	reservedMu.Unlock()
+
+	for _, r := range rs {
+		for _, b := range r.shadow {
+			if b != reservePoison {
+				panic("gmdbx: reserved slice written after the transaction was modified")
+			}
+		}
+	}
+}
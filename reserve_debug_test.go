@@ -0,0 +1,43 @@
+//go:build gmdbx_debug
+
+package gmdbx
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveLateWrite(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	tx := NewTransaction(db.env)
+	if e := db.env.Begin(tx, TxReadWrite); e != ErrSuccess {
+		t.Fatal(e)
+	}
+	dbi, e := tx.OpenDBI("reserve", DBCreate)
+	if e != ErrSuccess {
+		t.Fatal(e)
+	}
+	buf, err := tx.Reserve(dbi, []byte("a"), 4, PutUpsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(buf, "good")
+
+	// the next write ends the validity window of buf
+	k := StringConst("b")
+	tx.Put(dbi, &k, &k, PutUpsert)
+	copy(buf, "late")
+
+	assert.Panics(t, func() { tx.Commit() })
+	tx.Abort()
+}
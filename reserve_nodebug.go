@@ -0,0 +1,13 @@
+//go:build !gmdbx_debug
+
+package gmdbx
+
+const debugReserve = false
+
+func trackReserved(txn uintptr, page []byte) []byte {
+	return page
+}
+
+func flushReserved(txn uintptr) {}
+
+func endReserved(txn uintptr) {}
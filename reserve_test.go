@@ -0,0 +1,71 @@
+package gmdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserve(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	type record struct {
+		ID    uint64
+		Score float64
+	}
+	rec := record{ID: 7, Score: 1.5}
+
+	var dbi DBI
+	err = db.Update(func(tx *Tx) error {
+		var e Error
+		if dbi, e = tx.OpenDBI("reserve", DBCreate); e != ErrSuccess {
+			return e
+		}
+		buf, err := tx.Reserve(dbi, []byte("rec"), binary.Size(rec), PutUpsert)
+		if err != nil {
+			return err
+		}
+		if err = binary.Write(bytes.NewBuffer(buf[:0]), binary.BigEndian, rec); err != nil {
+			return err
+		}
+
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		defer cur.Close()
+		buf, err = cur.Reserve([]byte("str"), 5, PutUpsert)
+		if err != nil {
+			return err
+		}
+		copy(buf, "hello")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		k, v := StringConst("rec"), Val{}
+		if e := tx.Get(dbi, &k, &v); e != ErrSuccess {
+			return e
+		}
+		var got record
+		if err := binary.Read(bytes.NewReader(v.Bytes()), binary.BigEndian, &got); err != nil {
+			return err
+		}
+		assert.Equal(t, rec, got)
+
+		k = StringConst("str")
+		if e := tx.Get(dbi, &k, &v); e != ErrSuccess {
+			return e
+		}
+		assert.Equal(t, "hello", v.String())
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,231 @@
+package gmdbx
+
+import (
+	"errors"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrSnapshotClosed = errors.New("snapshot closed")
+
+// SnapshotOptions thresholds of a long-lived read snapshot
+type SnapshotOptions struct {
+	// MaxLag number of transactions committed after the snapshot was taken
+	// before it is considered stale, 0 disables the check.
+	MaxLag int
+	// MaxAge how long the snapshot may be held, 0 disables the check.
+	MaxAge time.Duration
+	// AutoRenew renew a stale snapshot instead of only reporting it.
+	AutoRenew bool
+	// CheckInterval how often the thresholds are checked, default 1s.
+	CheckInterval time.Duration
+	// OnStale called when a threshold is exceeded, by default the event
+	// is written to the standard logger.
+	OnStale func(info SnapshotInfo)
+}
+
+// SnapshotInfo state of a snapshot when it was checked
+type SnapshotInfo struct {
+	TxnID   uint64        // ID of the data version the snapshot saw
+	Lag     int           // transactions committed since the snapshot was taken
+	Percent int           // percentage of page allocation in the database
+	Age     time.Duration // time since the snapshot was taken
+	Renewed bool          // the snapshot was renewed because of this check
+}
+
+// Snapshot holds a read-only transaction open for a long time and watches how
+// far behind the head it falls, a lagging reader prevents the garbage
+// collection of pages retired by later writers.
+//
+// The transaction lives on a dedicated goroutine locked to its OS thread, all
+// methods may be called from any goroutine. Thresholds are checked between
+// calls to View, never while a callback runs.
+type Snapshot struct {
+	env  *Env
+	opts SnapshotOptions
+	tx   *Tx
+	born time.Time
+
+	txnID  uint64
+	calls  chan func()
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+}
+
+// NewSnapshot begin a read-only transaction and keep it open until Close
+func NewSnapshot(env *Env, opts SnapshotOptions) (*Snapshot, error) {
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = time.Second
+	}
+	if opts.OnStale == nil {
+		opts.OnStale = func(info SnapshotInfo) {
+			log.Printf("gmdbx: snapshot txn %d is stale, lag %d age %s renewed %v",
+				info.TxnID, info.Lag, info.Age, info.Renewed)
+		}
+	}
+	s := &Snapshot{
+		env:    env,
+		opts:   opts,
+		calls:  make(chan func()),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	ready := make(chan error, 1)
+	go s.loop(ready)
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Snapshot begin a long-lived read snapshot of the database
+func (d *DB) Snapshot(opts SnapshotOptions) (*Snapshot, error) {
+	return NewSnapshot(d.env, opts)
+}
+
+func (s *Snapshot) loop(ready chan<- error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(s.exited)
+
+	s.tx = NewTransaction(s.env)
+	if err := s.env.Begin(s.tx, TxReadOnly); err != ErrSuccess {
+		ready <- err
+		return
+	}
+	s.born = time.Now()
+	atomic.StoreUint64(&s.txnID, s.tx.ID())
+	ready <- nil
+
+	ticker := time.NewTicker(s.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case fn := <-s.calls:
+			fn()
+		case <-ticker.C:
+			s.check()
+		case <-s.done:
+			s.tx.Abort()
+			return
+		}
+	}
+}
+
+// do run fn on the goroutine owning the transaction, a panic of fn is
+// recovered there and raised again in the caller.
+func (s *Snapshot) do(fn func()) error {
+	finished := make(chan any, 1)
+	call := func() {
+		defer func() { finished <- recover() }()
+		fn()
+	}
+	select {
+	case s.calls <- call:
+	case <-s.exited:
+		return ErrSnapshotClosed
+	}
+	if p := <-finished; p != nil {
+		panic(p)
+	}
+	return nil
+}
+
+func (s *Snapshot) info() (SnapshotInfo, error) {
+	lag, percent, err := s.tx.Lag()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{
+		TxnID:   atomic.LoadUint64(&s.txnID),
+		Lag:     lag,
+		Percent: percent,
+		Age:     time.Since(s.born),
+	}, nil
+}
+
+func (s *Snapshot) renew() error {
+	if err := s.tx.Renew(); err != ErrSuccess {
+		return err
+	}
+	s.born = time.Now()
+	atomic.StoreUint64(&s.txnID, s.tx.ID())
+	return nil
+}
+
+func (s *Snapshot) check() (SnapshotInfo, error) {
+	info, err := s.info()
+	if err != nil {
+		return info, err
+	}
+	stale := (s.opts.MaxLag > 0 && info.Lag > s.opts.MaxLag) ||
+		(s.opts.MaxAge > 0 && info.Age > s.opts.MaxAge)
+	if !stale {
+		return info, nil
+	}
+	if s.opts.AutoRenew {
+		if err = s.renew(); err != nil {
+			return info, err
+		}
+		info.Renewed = true
+	}
+	s.opts.OnStale(info)
+	return info, nil
+}
+
+// View run fn inside the snapshot transaction, fn must not keep the
+// transaction or its cursors after it returns. A panic of fn is raised again
+// in the caller of View.
+func (s *Snapshot) View(fn func(tx *Tx) error) error {
+	var err error
+	if e := s.do(func() { err = fn(s.tx) }); e != nil {
+		return e
+	}
+	return err
+}
+
+// TxnID return the ID of the data version the snapshot currently sees
+func (s *Snapshot) TxnID() uint64 {
+	return atomic.LoadUint64(&s.txnID)
+}
+
+// Info return the current lag and age of the snapshot
+func (s *Snapshot) Info() (SnapshotInfo, error) {
+	var info SnapshotInfo
+	var err error
+	if e := s.do(func() { info, err = s.info() }); e != nil {
+		return info, e
+	}
+	return info, err
+}
+
+// Check compare the snapshot with the configured thresholds now, instead of
+// waiting for the next periodic check.
+func (s *Snapshot) Check() (SnapshotInfo, error) {
+	var info SnapshotInfo
+	var err error
+	if e := s.do(func() { info, err = s.check() }); e != nil {
+		return info, e
+	}
+	return info, err
+}
+
+// Renew move the snapshot to the most recent committed data version
+func (s *Snapshot) Renew() error {
+	var err error
+	if e := s.do(func() { err = s.renew() }); e != nil {
+		return e
+	}
+	return err
+}
+
+// Close abort the snapshot transaction
+func (s *Snapshot) Close() error {
+	s.once.Do(func() { close(s.done) })
+	<-s.exited
+	return nil
+}
@@ -0,0 +1,93 @@
+package gmdbx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotLag(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	var stale []SnapshotInfo
+	snap, err := db.Snapshot(SnapshotOptions{
+		MaxLag:        2,
+		AutoRenew:     true,
+		CheckInterval: time.Hour,
+		OnStale: func(info SnapshotInfo) {
+			stale = append(stale, info)
+		},
+	})
+	if err != nil {
+		t.Fatal("snapshot failed: ", err)
+	}
+	defer snap.Close()
+
+	first := snap.TxnID()
+	for i := 0; i < 3; i++ {
+		err = db.Update(func(tx *Tx) error {
+			dbi, e := tx.OpenDBI("snapshot", DBCreate)
+			if e != ErrSuccess {
+				return e
+			}
+			k := ToVal(i)
+			if e = tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+				return e
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := snap.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, info.Lag)
+	assert.Equal(t, first, info.TxnID)
+
+	info, err = snap.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, info.Renewed)
+	assert.Len(t, stale, 1)
+	assert.Equal(t, first+3, snap.TxnID())
+
+	info, err = snap.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, info.Lag)
+
+	snap.Close()
+	assert.Equal(t, ErrSnapshotClosed, snap.View(func(tx *Tx) error { return nil }))
+}
+
+func TestSnapshotViewPanic(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	snap, err := db.Snapshot(SnapshotOptions{CheckInterval: time.Hour})
+	if err != nil {
+		t.Fatal("snapshot failed: ", err)
+	}
+	defer snap.Close()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		snap.View(func(tx *Tx) error { panic("boom") })
+	})
+	assert.NoError(t, snap.View(func(tx *Tx) error { return nil }))
+	_, err = snap.Info()
+	assert.NoError(t, err)
+}
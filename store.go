@@ -0,0 +1,227 @@
+package gmdbx
+
+import (
+	"iter"
+)
+
+// Store typed view of a named table, keys and values are converted by
+// codecs. A Store holds no transaction and may be shared by goroutines, each
+// method works inside the transaction it is given. Returned values are
+// decoded copies and stay valid after the transaction ends.
+type Store[K, V any] struct {
+	dbi    DBI
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// NewStore open, or create with DBCreate in flags, the table name inside tx
+func NewStore[K, V any](tx *Tx, name string, flags DBFlags, keys Codec[K], values Codec[V]) (*Store[K, V], error) {
+	dbi, err := tx.OpenDBI(name, flags)
+	if err != ErrSuccess {
+		return nil, err
+	}
+	return &Store[K, V]{dbi: dbi, keys: keys, values: values}, nil
+}
+
+// OpenStore open the table name of the database, creating it if needed
+func OpenStore[K, V any](d *DB, name string, keys Codec[K], values Codec[V]) (*Store[K, V], error) {
+	var s *Store[K, V]
+	err := d.update(func(tx *Tx) (err error) {
+		s, err = NewStore(tx, name, DBCreate, keys, values)
+		return err
+	})
+	return s, err
+}
+
+// DBI return the handle of the table
+func (s *Store[K, V]) DBI() DBI {
+	return s.dbi
+}
+
+func (s *Store[K, V]) encodeKey(key K) (Val, error) {
+	b, err := s.keys.Encode(nil, key)
+	if err != nil {
+		return Val{}, err
+	}
+	return bytesVal(b), nil
+}
+
+// Get return the value of key, false if key does not exist
+func (s *Store[K, V]) Get(tx *Tx, key K) (V, bool, error) {
+	var zero V
+	k, err := s.encodeKey(key)
+	if err != nil {
+		return zero, false, err
+	}
+	var v Val
+	switch e := tx.Get(s.dbi, &k, &v); e {
+	case ErrSuccess:
+	case ErrNotFound:
+		return zero, false, nil
+	default:
+		return zero, false, e
+	}
+	value, err := s.values.Decode(v.UnsafeBytes())
+	if err != nil {
+		return zero, false, err
+	}
+	return value, true, nil
+}
+
+// Put set the value of key
+func (s *Store[K, V]) Put(tx *Tx, key K, value V) error {
+	k, err := s.encodeKey(key)
+	if err != nil {
+		return err
+	}
+	b, err := s.values.Encode(nil, value)
+	if err != nil {
+		return err
+	}
+	v := bytesVal(b)
+	if e := tx.Put(s.dbi, &k, &v, PutUpsert); e != ErrSuccess {
+		return e
+	}
+	return nil
+}
+
+// Delete remove key, false if it did not exist
+func (s *Store[K, V]) Delete(tx *Tx, key K) (bool, error) {
+	k, err := s.encodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	switch e := tx.Delete(s.dbi, &k, nil); e {
+	case ErrSuccess:
+		return true, nil
+	case ErrNotFound:
+		return false, nil
+	default:
+		return false, e
+	}
+}
+
+// Update read the value of key, the boolean reports whether it exists, and
+// store the value returned by fn. Nothing is written if fn fails.
+func (s *Store[K, V]) Update(tx *Tx, key K, fn func(V, bool) (V, error)) error {
+	old, ok, err := s.Get(tx, key)
+	if err != nil {
+		return err
+	}
+	value, err := fn(old, ok)
+	if err != nil {
+		return err
+	}
+	return s.Put(tx, key, value)
+}
+
+// Iter return an iterator over the table inside tx
+func (s *Store[K, V]) Iter(tx *Tx) *StoreIter[K, V] {
+	return &StoreIter[K, V]{s: s, tx: tx}
+}
+
+// StoreIter typed iteration of a Store inside a transaction, an error
+// stopping an iterator early is reported by Err.
+type StoreIter[K, V any] struct {
+	s   *Store[K, V]
+	tx  *Tx
+	err error
+}
+
+// Err return the error which stopped the last iteration, if any
+func (it *StoreIter[K, V]) Err() error {
+	return it.err
+}
+
+// All iterate over all pairs in key order
+func (it *StoreIter[K, V]) All() iter.Seq2[K, V] {
+	return it.Range(nil, nil)
+}
+
+// Range iterate in key order from the first key greater than or equal to
+// from, up to but not including to. A nil bound is open.
+func (it *StoreIter[K, V]) Range(from, to *K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		it.each(from, to, false, yield)
+	}
+}
+
+// Keys iterate over the keys in order without decoding the values
+func (it *StoreIter[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		it.each(nil, nil, true, func(k K, _ V) bool { return yield(k) })
+	}
+}
+
+// Backward iterate over all pairs in reverse key order
+func (it *StoreIter[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		it.err = nil
+		cur, e := it.tx.OpenCursor(it.s.dbi)
+		if e != ErrSuccess {
+			it.err = e
+			return
+		}
+		defer cur.Close()
+
+		var k, v Val
+		for e = cur.Get(&k, &v, CursorLast); e == ErrSuccess; e = cur.Get(&k, &v, CursorPrev) {
+			key, value, ok := it.decode(&k, &v, false)
+			if !ok || !yield(key, value) {
+				return
+			}
+		}
+		if e != ErrNotFound {
+			it.err = e
+		}
+	}
+}
+
+func (it *StoreIter[K, V]) each(from, to *K, keysOnly bool, yield func(K, V) bool) {
+	it.err = nil
+	cur, e := it.tx.OpenCursor(it.s.dbi)
+	if e != ErrSuccess {
+		it.err = e
+		return
+	}
+	defer cur.Close()
+
+	var k, v, end Val
+	if to != nil {
+		if end, it.err = it.s.encodeKey(*to); it.err != nil {
+			return
+		}
+	}
+	if from != nil {
+		if k, it.err = it.s.encodeKey(*from); it.err != nil {
+			return
+		}
+		e = cur.Get(&k, &v, CursorSetRange)
+	} else {
+		e = cur.Get(&k, &v, CursorFirst)
+	}
+	for ; e == ErrSuccess; e = cur.Get(&k, &v, CursorNext) {
+		if to != nil && it.tx.Cmp(it.s.dbi, &k, &end) >= 0 {
+			return
+		}
+		key, value, ok := it.decode(&k, &v, keysOnly)
+		if !ok || !yield(key, value) {
+			return
+		}
+	}
+	if e != ErrNotFound {
+		it.err = e
+	}
+}
+
+func (it *StoreIter[K, V]) decode(k, v *Val, keysOnly bool) (key K, value V, ok bool) {
+	if key, it.err = it.s.keys.Decode(k.UnsafeBytes()); it.err != nil {
+		return key, value, false
+	}
+	if !keysOnly {
+		if value, it.err = it.s.values.Decode(v.UnsafeBytes()); it.err != nil {
+			return key, value, false
+		}
+	}
+	return key, value, true
+}
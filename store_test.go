@@ -0,0 +1,219 @@
+package gmdbx
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type storeUser struct {
+	Name string
+	Age  int
+}
+
+// storeBlob keeps the slice given to UnmarshalBinary
+type storeBlob struct {
+	b []byte
+}
+
+func (s storeBlob) MarshalBinary() ([]byte, error) { return s.b, nil }
+
+func (s *storeBlob) UnmarshalBinary(b []byte) error {
+	s.b = b
+	return nil
+}
+
+func TestIntCodecOrder(t *testing.T) {
+	i8 := []int8{math.MinInt8, -1, 0, 1, math.MaxInt8}
+	var prev []byte
+	for _, v := range i8 {
+		b, err := IntCodec[int8]{}.Encode(nil, v)
+		assert.NoError(t, err)
+		assert.Len(t, b, 1)
+		d, err := IntCodec[int8]{}.Decode(b)
+		assert.NoError(t, err)
+		assert.Equal(t, v, d)
+		assert.Negative(t, bytes.Compare(prev, b))
+		prev = b
+	}
+
+	prev = nil
+	for _, v := range []int64{math.MinInt64, -1 << 33, -1, 0, 1 << 33, math.MaxInt64} {
+		b, _ := IntCodec[int64]{}.Encode(nil, v)
+		d, err := IntCodec[int64]{}.Decode(b)
+		assert.NoError(t, err)
+		assert.Equal(t, v, d)
+		assert.Negative(t, bytes.Compare(prev, b))
+		prev = b
+	}
+
+	b, _ := IntCodec[uint16]{}.Encode(nil, 0xabcd)
+	assert.Equal(t, []byte{0xab, 0xcd}, b)
+	_, err := IntCodec[uint16]{}.Decode([]byte{1})
+	assert.Equal(t, ErrCodecSize, err)
+}
+
+func TestCodecs(t *testing.T) {
+	u := storeUser{Name: "ann", Age: 30}
+
+	b, err := JSONCodec[storeUser]{}.Encode(nil, u)
+	assert.NoError(t, err)
+	got, err := JSONCodec[storeUser]{}.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, u, got)
+
+	b, err = GobCodec[storeUser]{}.Encode([]byte("prefix"), u)
+	assert.NoError(t, err)
+	got, err = GobCodec[storeUser]{}.Decode(b[len("prefix"):])
+	assert.NoError(t, err)
+	assert.Equal(t, u, got)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	b, err = BinaryCodec[time.Time, *time.Time]{}.Encode(nil, now)
+	assert.NoError(t, err)
+	tm, err := BinaryCodec[time.Time, *time.Time]{}.Decode(b)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(tm))
+
+	// the decoded value does not alias the stored bytes
+	b = []byte("blob")
+	blob, err := BinaryCodec[storeBlob, *storeBlob]{}.Decode(b)
+	assert.NoError(t, err)
+	b[0] = 'X'
+	assert.Equal(t, []byte("blob"), blob.b)
+
+	b, _ = FloatCodec{}.Encode(nil, -2.5)
+	f, err := FloatCodec{}.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, -2.5, f)
+}
+
+func TestStore(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	users, err := OpenStore(db, "users", IntCodec[int]{}, JSONCodec[storeUser]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int{5, -3, 100, 0, -70, 42}
+	err = db.Update(func(tx *Tx) error {
+		for _, id := range ids {
+			if err := users.Put(tx, id, storeUser{Name: "u", Age: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Ints(ids)
+
+	var u storeUser
+	err = db.View(func(tx *Tx) error {
+		var ok bool
+		u, ok, err = users.Get(tx, 42)
+		assert.True(t, ok)
+		if err != nil {
+			return err
+		}
+		_, ok, err = users.Get(tx, 7)
+		assert.False(t, ok)
+		return err
+	})
+	assert.NoError(t, err)
+	// values outlive the transaction
+	assert.Equal(t, storeUser{Name: "u", Age: 42}, u)
+
+	err = db.View(func(tx *Tx) error {
+		it := users.Iter(tx)
+		var got []int
+		for id, u := range it.All() {
+			assert.Equal(t, id, u.Age)
+			got = append(got, id)
+		}
+		assert.Equal(t, ids, got)
+
+		got = got[:0]
+		from, to := -3, 42
+		for id := range it.Range(&from, &to) {
+			got = append(got, id)
+		}
+		assert.Equal(t, []int{-3, 0, 5}, got)
+
+		got = got[:0]
+		for id := range it.Keys() {
+			got = append(got, id)
+			if len(got) == 2 {
+				break
+			}
+		}
+		assert.Equal(t, []int{-70, -3}, got)
+
+		got = got[:0]
+		for id := range it.Backward() {
+			got = append(got, id)
+		}
+		assert.Equal(t, []int{100, 42, 5, 0, -3, -70}, got)
+		return it.Err()
+	})
+	assert.NoError(t, err)
+
+	failed := errors.New("failed")
+	err = db.Update(func(tx *Tx) error {
+		err := users.Update(tx, 5, func(u storeUser, ok bool) (storeUser, error) {
+			assert.True(t, ok)
+			u.Name = "five"
+			return u, nil
+		})
+		if err != nil {
+			return err
+		}
+		err = users.Update(tx, 6, func(u storeUser, ok bool) (storeUser, error) {
+			assert.False(t, ok)
+			return u, failed
+		})
+		assert.Equal(t, failed, err)
+
+		ok, err := users.Delete(tx, 100)
+		assert.True(t, ok)
+		if err != nil {
+			return err
+		}
+		ok, err = users.Delete(tx, 100)
+		assert.False(t, ok)
+		return err
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx *Tx) error {
+		u, _, err := users.Get(tx, 5)
+		assert.Equal(t, "five", u.Name)
+		_, ok, _ := users.Get(tx, 6)
+		assert.False(t, ok)
+		_, ok, _ = users.Get(tx, 100)
+		assert.False(t, ok)
+		return err
+	})
+	assert.NoError(t, err)
+
+	// a value the codec can not decode stops the iteration
+	names, err := OpenStore(db, "users", IntCodec[int]{}, IntCodec[int64]{})
+	assert.NoError(t, err)
+	err = db.View(func(tx *Tx) error {
+		it := names.Iter(tx)
+		for range it.All() {
+			t.Fatal("unexpected pair")
+		}
+		return it.Err()
+	})
+	assert.Equal(t, ErrCodecSize, err)
+}
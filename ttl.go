@@ -0,0 +1,443 @@
+package gmdbx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TTLTable reserved table of the deadlines ordered by time, keyed by the
+	// deadline in big-endian unix nanoseconds followed by the table name and
+	// the key, like CmpU64PrefixLexical keys sorted by the default comparator.
+	TTLTable = "__ttl"
+	// TTLKeysTable reserved table mapping the table name and the key of each
+	// expiring pair to its deadline
+	TTLKeysTable = "__ttl_keys"
+)
+
+// TTLStats metrics of expiring pairs
+type TTLStats struct {
+	Purged uint64 // expired pairs deleted by Sweep
+	Txns   uint64 // write transactions committed by Sweep
+	Errors uint64 // failed sweeps of a Sweeper
+}
+
+// ttlState tables enabled with EnableTTL, copied on write so transactions
+// read it without locking.
+type ttlState struct {
+	expiry DBI
+	keys   DBI
+	tables map[DBI]*ttlTable
+	byName map[string]DBI
+}
+
+type ttlTable struct {
+	name   string
+	prefix []byte // uvarint framed name, leading the keys of both tables
+}
+
+// ttlHook removes the deadline of a pair when it is written or deleted
+type ttlHook struct {
+	db    *DB
+	table *ttlTable
+}
+
+// removed forget a deleted table, its deadlines are left to Sweep
+func (h *ttlHook) removed(dbi DBI) {
+	d := h.db
+	d.ttlMu.Lock()
+	defer d.ttlMu.Unlock()
+	old := d.env.ttl.Load()
+	if old == nil || old.tables[dbi] != h.table {
+		return
+	}
+	st := &ttlState{expiry: old.expiry, keys: old.keys, tables: map[DBI]*ttlTable{}, byName: map[string]DBI{}}
+	for k, t := range old.tables {
+		if k != dbi {
+			st.tables[k] = t
+			st.byName[t.name] = k
+		}
+	}
+	d.env.ttl.Store(st)
+}
+
+// EnableTTL allow the pairs of tables to expire, the tables are created if
+// needed. Deadlines are stored in TTLTable and TTLKeysTable, EnableTTL must be
+// called again each time the database is opened. Tables with DBDupSort are
+// refused with ErrIncompatible.
+func (d *DB) EnableTTL(tables ...string) error {
+	d.ttlMu.Lock()
+	defer d.ttlMu.Unlock()
+
+	st := &ttlState{tables: map[DBI]*ttlTable{}, byName: map[string]DBI{}}
+	if old := d.env.ttl.Load(); old != nil {
+		for dbi, t := range old.tables {
+			st.tables[dbi] = t
+		}
+		for name, dbi := range old.byName {
+			st.byName[name] = dbi
+		}
+	}
+	added := map[DBI]*ttlTable{}
+	err := d.update(func(tx *Tx) error {
+		var err Error
+		if st.expiry, err = tx.OpenDBI(TTLTable, DBCreate); err != ErrSuccess {
+			return err
+		}
+		if st.keys, err = tx.OpenDBI(TTLKeysTable, DBCreate); err != ErrSuccess {
+			return err
+		}
+		for _, name := range tables {
+			if _, ok := st.byName[name]; ok {
+				continue
+			}
+			dbi, err := tx.OpenDBI(name, DBCreate)
+			if err != ErrSuccess {
+				return err
+			}
+			flags, _, err := tx.DBIFlags(dbi)
+			if err != ErrSuccess {
+				return err
+			}
+			if flags&DBDupSort != 0 {
+				return fmt.Errorf("ttl: table %s is DBDupSort: %w", name, ErrIncompatible)
+			}
+			prefix := binary.AppendUvarint(nil, uint64(len(name)))
+			added[dbi] = &ttlTable{name: name, prefix: append(prefix, name...)}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for dbi, t := range added {
+		st.tables[dbi] = t
+		st.byName[t.name] = dbi
+		d.env.addHook(dbi, &ttlHook{db: d, table: t})
+	}
+	d.env.ttl.Store(st)
+	return nil
+}
+
+func (env *Env) ttlTable(dbi DBI) (*ttlState, *ttlTable) {
+	if st := env.ttl.Load(); st != nil {
+		if t := st.tables[dbi]; t != nil {
+			return st, t
+		}
+	}
+	return nil, nil
+}
+
+// PutWithTTL store a pair of a table enabled with DB.EnableTTL which expires
+// after ttl. Get reports an expired pair as missing until Sweep deletes it,
+// cursors still see it. A later Put of the key makes it permanent again.
+func (tx *Tx) PutWithTTL(dbi DBI, key *Val, data *Val, ttl time.Duration) Error {
+	st, t := tx.env.ttlTable(dbi)
+	if t == nil {
+		return ErrIncompatible
+	}
+	if ttl <= 0 {
+		return ErrEINVAL
+	}
+	if err := tx.Put(dbi, key, data, PutUpsert); err != ErrSuccess {
+		return err
+	}
+	return tx.setDeadline(st, t, key.UnsafeBytes(), uint64(time.Now().Add(ttl).UnixNano()))
+}
+
+// Expiry return the deadline of a pair, the zero time if it does not expire.
+// An expired pair is reported with ErrNotFound.
+func (tx *Tx) Expiry(dbi DBI, key *Val) (time.Time, Error) {
+	var data Val
+	if err := tx.Get(dbi, key, &data); err != ErrSuccess {
+		return time.Time{}, err
+	}
+	st, t := tx.env.ttlTable(dbi)
+	if t == nil {
+		return time.Time{}, ErrSuccess
+	}
+	deadline, err := tx.deadline(st, t, key.UnsafeBytes())
+	if err != ErrSuccess || deadline == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(deadline)), ErrSuccess
+}
+
+// getLive get a pair of a table with TTL, unless it expired
+func (tx *Tx) getLive(st *ttlState, t *ttlTable, dbi DBI, key *Val, data *Val) Error {
+	if err := tx.get(dbi, key, data); err != ErrSuccess {
+		return err
+	}
+	deadline, err := tx.deadline(st, t, key.UnsafeBytes())
+	if err != ErrSuccess {
+		return err
+	}
+	if deadline != 0 && deadline <= uint64(time.Now().UnixNano()) {
+		*data = Val{}
+		return ErrNotFound
+	}
+	return ErrSuccess
+}
+
+func (t *ttlTable) keysKey(key []byte) []byte {
+	return append(t.prefix[:len(t.prefix):len(t.prefix)], key...)
+}
+
+func expiryKey(deadline uint64, keysKey []byte) []byte {
+	b := make([]byte, 8, 8+len(keysKey))
+	binary.BigEndian.PutUint64(b, deadline)
+	return append(b, keysKey...)
+}
+
+// deadline return the deadline of key, 0 if it has none
+func (tx *Tx) deadline(st *ttlState, t *ttlTable, key []byte) (uint64, Error) {
+	k, v := bytesVal(t.keysKey(key)), Val{}
+	switch err := tx.get(st.keys, &k, &v); err {
+	case ErrSuccess:
+		if v.Len != 8 {
+			return 0, ErrCorrupted
+		}
+		return binary.BigEndian.Uint64(v.UnsafeBytes()), ErrSuccess
+	case ErrNotFound:
+		return 0, ErrSuccess
+	default:
+		return 0, err
+	}
+}
+
+func (tx *Tx) setDeadline(st *ttlState, t *ttlTable, key []byte, deadline uint64) Error {
+	kk := t.keysKey(key)
+	ek := expiryKey(deadline, kk)
+	var d [8]byte
+	binary.BigEndian.PutUint64(d[:], deadline)
+	k, v := bytesVal(kk), bytesVal(d[:])
+	if err := tx.put(st.keys, &k, &v, PutUpsert); err != ErrSuccess {
+		return err
+	}
+	k, v = bytesVal(ek), Val{}
+	return tx.put(st.expiry, &k, &v, PutUpsert)
+}
+
+// clearDeadline remove the deadline of key, if any
+func (tx *Tx) clearDeadline(st *ttlState, keysKey []byte) Error {
+	k, v := bytesVal(keysKey), Val{}
+	switch err := tx.get(st.keys, &k, &v); err {
+	case ErrSuccess:
+	case ErrNotFound:
+		return ErrSuccess
+	default:
+		return err
+	}
+	if v.Len != 8 {
+		return ErrCorrupted
+	}
+	ek := bytesVal(expiryKey(binary.BigEndian.Uint64(v.UnsafeBytes()), keysKey))
+	if err := tx.delete(st.expiry, &ek, nil); err != ErrSuccess && err != ErrNotFound {
+		return err
+	}
+	return tx.delete(st.keys, &k, nil)
+}
+
+func (h *ttlHook) check(tx *Tx, c *change) Error {
+	return ErrSuccess
+}
+
+func (h *ttlHook) apply(tx *Tx, c *change) Error {
+	st := tx.env.ttl.Load()
+	return tx.clearDeadline(st, h.table.keysKey(c.key))
+}
+
+func (h *ttlHook) drop(tx *Tx, dbi DBI) Error {
+	st := tx.env.ttl.Load()
+	cur, err := tx.OpenCursor(st.keys)
+	if err != ErrSuccess {
+		return err
+	}
+	var owned [][]byte
+	k, v := bytesVal(h.table.prefix), Val{}
+	for err = cur.Get(&k, &v, CursorSetRange); err == ErrSuccess; err = cur.Get(&k, &v, CursorNext) {
+		b := k.UnsafeBytes()
+		if len(b) < len(h.table.prefix) || string(b[:len(h.table.prefix)]) != string(h.table.prefix) {
+			break
+		}
+		owned = append(owned, k.Bytes())
+	}
+	cur.Close()
+	if err != ErrSuccess && err != ErrNotFound {
+		return err
+	}
+	for _, kk := range owned {
+		if err = tx.clearDeadline(st, kk); err != ErrSuccess {
+			return err
+		}
+	}
+	return ErrSuccess
+}
+
+// Sweep delete up to limit expired pairs in one write transaction, the
+// earliest deadlines first. It returns the number of pairs deleted.
+func (d *DB) Sweep(limit int) (int, error) {
+	st := d.env.ttl.Load()
+	if st == nil || limit <= 0 {
+		return 0, nil
+	}
+	var n int
+	err := d.update(func(tx *Tx) error {
+		n = 0
+		now := uint64(time.Now().UnixNano())
+		cur, err := tx.OpenCursor(st.expiry)
+		if err != ErrSuccess {
+			return err
+		}
+		var expired [][]byte
+		var k, v Val
+		for err = cur.Get(&k, &v, CursorFirst); err == ErrSuccess && len(expired) < limit; err = cur.Get(&k, &v, CursorNext) {
+			b := k.UnsafeBytes()
+			if len(b) < 8 || binary.BigEndian.Uint64(b) > now {
+				break
+			}
+			expired = append(expired, k.Bytes())
+		}
+		cur.Close()
+		if err != ErrSuccess && err != ErrNotFound {
+			return err
+		}
+
+		for _, ek := range expired {
+			kk := ek[8:]
+			size, w := binary.Uvarint(kk)
+			if w <= 0 || uint64(len(kk)-w) < size {
+				return ErrCorrupted
+			}
+			name, key := string(kk[w:w+int(size)]), bytesVal(kk[w+int(size):])
+			dbi, ok := st.byName[name]
+			if !ok {
+				// not enabled since the database was opened, there is no hook
+				switch dbi, err = tx.OpenDBI(name, 0); err {
+				case ErrSuccess:
+					ok = true
+				case ErrNotFound:
+				default:
+					return err
+				}
+			}
+			if ok {
+				switch err = tx.Delete(dbi, &key, nil); err {
+				case ErrSuccess:
+					n++
+				case ErrNotFound:
+				default:
+					return err
+				}
+			}
+			if err = tx.clearDeadline(st, kk); err != ErrSuccess {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	atomic.AddUint64(&d.ttlStats.Purged, uint64(n))
+	atomic.AddUint64(&d.ttlStats.Txns, 1)
+	return n, nil
+}
+
+// TTLStats return the metrics of expiring pairs
+func (d *DB) TTLStats() TTLStats {
+	return TTLStats{
+		Purged: atomic.LoadUint64(&d.ttlStats.Purged),
+		Txns:   atomic.LoadUint64(&d.ttlStats.Txns),
+		Errors: atomic.LoadUint64(&d.ttlStats.Errors),
+	}
+}
+
+// SweeperOptions configuration of a Sweeper
+type SweeperOptions struct {
+	// Interval delay between sweeps, default 1s.
+	Interval time.Duration
+	// BatchSize maximum pairs deleted per write transaction, default 1000.
+	// A sweep commits batches until fewer expired pairs remain.
+	BatchSize int
+}
+
+// Sweeper deletes expired pairs in the background
+type Sweeper struct {
+	db   *DB
+	opts SweeperOptions
+
+	once   sync.Once
+	stop   chan struct{}
+	exited chan struct{}
+}
+
+// StartSweeper start deleting expired pairs periodically, until the sweeper
+// or the database is closed.
+func (d *DB) StartSweeper(opts SweeperOptions) *Sweeper {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	s := &Sweeper{db: d, opts: opts, stop: make(chan struct{}), exited: make(chan struct{})}
+	d.ttlMu.Lock()
+	d.sweepers[s] = struct{}{}
+	d.ttlMu.Unlock()
+	go s.run()
+	return s
+}
+
+func (s *Sweeper) run() {
+	defer close(s.exited)
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		for {
+			n, err := s.db.Sweep(s.opts.BatchSize)
+			if err != nil {
+				atomic.AddUint64(&s.db.ttlStats.Errors, 1)
+				break
+			}
+			if n < s.opts.BatchSize {
+				break
+			}
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// Close stop the sweeper and wait for the running sweep
+func (s *Sweeper) Close() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.exited
+	s.db.ttlMu.Lock()
+	delete(s.db.sweepers, s)
+	s.db.ttlMu.Unlock()
+}
+
+func (d *DB) closeSweepers() {
+	d.ttlMu.Lock()
+	sweepers := make([]*Sweeper, 0, len(d.sweepers))
+	for s := range d.sweepers {
+		sweepers = append(sweepers, s)
+	}
+	d.ttlMu.Unlock()
+	for _, s := range sweepers {
+		s.Close()
+	}
+}
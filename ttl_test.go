@@ -0,0 +1,161 @@
+package gmdbx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ttlPut(tx *Tx, dbi DBI, key, value string, ttl time.Duration) Error {
+	k, v := bytesVal([]byte(key)), bytesVal([]byte(value))
+	return tx.PutWithTTL(dbi, &k, &v, ttl)
+}
+
+func ttlGet(tx *Tx, dbi DBI, key string) (string, Error) {
+	k, v := bytesVal([]byte(key)), Val{}
+	err := tx.Get(dbi, &k, &v)
+	return v.String(), err
+}
+
+func ttlKeys(t *testing.T, db *DB, dbi DBI) []string {
+	keys, _ := loaderContents(t, db, dbi)
+	var out []string
+	for _, k := range keys {
+		out = append(out, string(k))
+	}
+	return out
+}
+
+func TestTTL(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	assert.NoError(t, db.EnableTTL("sessions"))
+	dbi := openLoaderDBI(t, db, "sessions", DBCreate)
+	plain := openLoaderDBI(t, db, "plain", DBCreate)
+	expiry := openLoaderDBI(t, db, TTLTable, 0)
+
+	err = db.update(func(tx *Tx) error {
+		assert.Equal(t, ErrSuccess, ttlPut(tx, dbi, "a", "1", time.Hour))
+		assert.Equal(t, ErrSuccess, ttlPut(tx, dbi, "b", "2", 20*time.Millisecond))
+		assert.Equal(t, ErrSuccess, indexPut(tx, dbi, "c", "3"))
+		assert.Equal(t, ErrSuccess, ttlPut(tx, dbi, "d", "4", 20*time.Millisecond))
+		assert.Equal(t, ErrSuccess, ttlPut(tx, dbi, "e", "5", 20*time.Millisecond))
+		// a plain put makes d permanent
+		assert.Equal(t, ErrSuccess, indexPut(tx, dbi, "d", "4"))
+
+		assert.Equal(t, ErrIncompatible, ttlPut(tx, plain, "a", "1", time.Hour))
+		assert.Equal(t, ErrEINVAL, ttlPut(tx, dbi, "a", "1", 0))
+
+		v, e := ttlGet(tx, dbi, "b")
+		assert.Equal(t, ErrSuccess, e)
+		assert.Equal(t, "2", v)
+
+		k := bytesVal([]byte("a"))
+		deadline, e := tx.Expiry(dbi, &k)
+		assert.Equal(t, ErrSuccess, e)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+		k = bytesVal([]byte("c"))
+		deadline, e = tx.Expiry(dbi, &k)
+		assert.Equal(t, ErrSuccess, e)
+		assert.True(t, deadline.IsZero())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ttlKeys(t, db, expiry), 3)
+
+	time.Sleep(30 * time.Millisecond)
+	err = db.update(func(tx *Tx) error {
+		for key, want := range map[string]string{"a": "1", "c": "3", "d": "4"} {
+			v, e := ttlGet(tx, dbi, key)
+			assert.Equal(t, ErrSuccess, e, key)
+			assert.Equal(t, want, v)
+		}
+		for _, key := range []string{"b", "e"} {
+			_, e := ttlGet(tx, dbi, key)
+			assert.Equal(t, ErrNotFound, e, key)
+			k := bytesVal([]byte(key))
+			_, e = tx.Expiry(dbi, &k)
+			assert.Equal(t, ErrNotFound, e, key)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	// expired pairs remain until swept
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ttlKeys(t, db, dbi))
+
+	n, err := db.Sweep(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.Sweep(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.Sweep(10)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, TTLStats{Purged: 2, Txns: 3}, db.TTLStats())
+	assert.Equal(t, []string{"a", "c", "d"}, ttlKeys(t, db, dbi))
+	assert.Len(t, ttlKeys(t, db, expiry), 1)
+
+	// deleting or dropping removes the deadlines
+	err = db.update(func(tx *Tx) error {
+		k := bytesVal([]byte("a"))
+		if e := tx.Delete(dbi, &k, nil); e != ErrSuccess {
+			return e
+		}
+		if e := ttlPut(tx, dbi, "f", "6", time.Hour); e != ErrSuccess {
+			return e
+		}
+		if e := tx.Drop(dbi, false); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, ttlKeys(t, db, expiry))
+	assert.Empty(t, ttlKeys(t, db, openLoaderDBI(t, db, TTLKeysTable, 0)))
+
+	multi := openLoaderDBI(t, db, "multi", DBCreate|DBDupSort)
+	assert.NoError(t, db.update(func(tx *Tx) error {
+		if e := indexPut(tx, multi, "a", "1"); e != ErrSuccess {
+			return e
+		}
+		return nil
+	}))
+	assert.ErrorIs(t, db.EnableTTL("multi"), ErrIncompatible)
+}
+
+func TestSweeper(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	assert.NoError(t, db.EnableTTL("sessions"))
+	dbi := openLoaderDBI(t, db, "sessions", DBCreate)
+
+	err = db.update(func(tx *Tx) error {
+		for _, k := range []string{"a", "b", "c"} {
+			if e := ttlPut(tx, dbi, k, "v", time.Millisecond); e != ErrSuccess {
+				return e
+			}
+		}
+		if e := ttlPut(tx, dbi, "d", "v", time.Hour); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	s := db.StartSweeper(SweeperOptions{Interval: 5 * time.Millisecond, BatchSize: 2})
+	assert.Eventually(t, func() bool { return db.TTLStats().Purged == 3 }, 5*time.Second, time.Millisecond)
+	s.Close()
+	assert.GreaterOrEqual(t, db.TTLStats().Txns, uint64(2))
+	assert.Equal(t, []string{"d"}, ttlKeys(t, db, dbi))
+
+	// closing the database stops the sweepers left running
+	db.StartSweeper(SweeperOptions{Interval: time.Millisecond})
+}
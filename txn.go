@@ -3,6 +3,9 @@ package gmdbx
 //#include "mdbxgo.h"
 import "C"
 import (
+	"context"
+	"runtime/cgo"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/sunvim/gmdbx/unsafecgo"
@@ -95,6 +98,23 @@ type Tx struct {
 	reset     bool
 	aborted   bool
 	committed bool
+	born      int64
+	ctx       context.Context
+	breaking  atomic.Bool // Break made by another thread, not applied yet
+	userData  cgo.Handle
+	cursors   []*C.cursor_ctx
+	// cursorStacks where each of cursors was opened, in a debug build
+	cursorStacks [][]byte
+	onCommit     []func(txnID uint64)
+	droppedHooks []DBI // tables deleted by Drop, their hooks go on commit
+	watched      []watchedChange
+	changelog    changelogState
+
+	gated      uint8       // how the compaction gate of env counts it
+	epoch      uint64      // Env.epoch when the transaction began
+	capture    *compactLog // compaction recording the writes
+	captured   []capturedOp
+	uncaptured bool // a write could not be recorded
 }
 
 func NewTransaction(env *Env) *Tx {
@@ -117,11 +137,34 @@ func (tx *Tx) IsCommitted() bool {
 }
 
 func (env *Env) Begin(txn *Tx, flags TxFlags) Error {
+	txn.leave()
 	txn.env = env
+	txn.gated = env.enter(flags&TxReadOnly == 0)
+	if err := env.begin(txn, flags); err != ErrSuccess {
+		txn.leave()
+		return err
+	}
+	return ErrSuccess
+}
+
+// begin a transaction ignoring the compaction gate
+func (env *Env) begin(txn *Tx, flags TxFlags) Error {
+	txn.env = env
+	txn.epoch = env.epoch
 	txn.txn = nil
 	txn.reset = false
 	txn.aborted = false
 	txn.committed = false
+	txn.ctx = nil
+	txn.breaking.Store(false)
+	txn.cursors = txn.cursors[:0]
+	txn.cursorStacks = txn.cursorStacks[:0]
+	txn.clearOnCommit()
+	txn.changelog = changelogState{}
+	txn.clearCapture()
+	if flags&TxReadOnly == 0 {
+		txn.capture = env.capture.Load()
+	}
 	args := struct {
 		env     uintptr
 		parent  uintptr
@@ -209,7 +252,7 @@ func (tx *Tx) Info(info *TxInfo) Error {
 		scanRlt int32
 		result  Error
 	}{
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		info: uintptr(unsafe.Pointer(info)),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
@@ -232,7 +275,7 @@ func (tx *Tx) Flags() int32 {
 		txn   uintptr
 		flags int32
 	}{
-		txn: uintptr(unsafe.Pointer(tx.txn)),
+		txn: tx.handle(),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_flags), ptr, 0)
@@ -256,13 +299,46 @@ func (tx *Tx) ID() uint64 {
 		txn uintptr
 		id  uint64
 	}{
-		txn: uintptr(unsafe.Pointer(tx.txn)),
+		txn: tx.handle(),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_id), ptr, 0)
 	return args.id
 }
 
+// Lag Returns a lag of the reading for the given transaction.
+// ingroup c_statinfo
+//
+// Returns an information for estimate how much given read-only
+// transaction is lagging relative the to actual head.
+//
+// param [in] txn       A transaction handle returned by ref mdbx_txn_begin().
+// param [out] percent  Percentage of page allocation in the database.
+//
+// returns Number of transactions committed after the given was started for
+// read, for a write transaction the lag is always 0.
+func (tx *Tx) Lag() (lag int, percent int, err error) {
+	var pct int32
+	args := struct {
+		txn     uintptr
+		percent uintptr
+		result  int32
+	}{
+		txn:     tx.handle(),
+		percent: uintptr(unsafe.Pointer(&pct)),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_straggler), ptr, 0)
+	if args.result < 0 {
+		// MDBX error codes are negative already, errno values are negated
+		if Error(args.result) >= ErrKeyExist && Error(args.result) <= ErrLastAddedErrcode {
+			return 0, 0, Error(args.result)
+		}
+		return 0, 0, Error(-args.result)
+	}
+	return int(args.result), int(pct), nil
+}
+
 // CommitLatency of commit stages in 1/65536 of seconds units.
 // warning This structure may be changed in future releases.
 // see mdbx_txn_commit_ex()
@@ -289,16 +365,26 @@ type CommitLatency struct {
 // ingroup c_statinfo
 // warning This function may be changed in future releases.
 func (tx *Tx) CommitEx(latency *CommitLatency) Error {
+	if debugReserve {
+		endReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
+	tx.untrackCursors()
+	id, publishing := tx.beforeCommit()
 	args := struct {
 		txn     uintptr
 		latency uintptr
 		result  Error
 	}{
-		txn:     uintptr(unsafe.Pointer(tx.txn)),
+		txn:     tx.handle(),
 		latency: uintptr(unsafe.Pointer(latency)),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_commit_ex), ptr, 0)
+	tx.afterCommit(id, publishing, args.result)
+	if args.result != ErrThreadMismatch {
+		tx.releaseUserData()
+		tx.leave()
+	}
 	return args.result
 }
 
@@ -396,6 +482,9 @@ func (tx *Tx) Commit() Error {
 //
 // retval MDBX_EINVAL           Transaction handle is NULL.
 func (tx *Tx) Abort() Error {
+	if debugReserve {
+		endReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
 	args := struct {
 		txn    uintptr
 		result Error
@@ -403,8 +492,15 @@ func (tx *Tx) Abort() Error {
 		txn: uintptr(unsafe.Pointer(tx.txn)),
 	}
 	tx.aborted = true
+	tx.untrackCursors()
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_abort), ptr, 0)
+	if args.result != ErrThreadMismatch {
+		tx.releaseUserData()
+		tx.clearOnCommit()
+		tx.clearCapture()
+		tx.leave()
+	}
 	return args.result
 }
 
@@ -419,6 +515,9 @@ func (tx *Tx) Abort() Error {
 //
 // see mdbx_txn_abort() see mdbx_txn_reset() see mdbx_txn_commit()
 // returns A non-zero error value on failure and 0 on success.
+//
+// Called from another thread than the one owning the transaction, the break
+// is applied by the owner on its next operation.
 func (tx *Tx) Break() Error {
 	args := struct {
 		txn    uintptr
@@ -428,9 +527,22 @@ func (tx *Tx) Break() Error {
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_break), ptr, 0)
+	if args.result == ErrThreadMismatch {
+		tx.breaking.Store(true)
+		return ErrSuccess
+	}
 	return args.result
 }
 
+// handle return the libmdbx transaction, applying a Break made by another
+// thread first.
+func (tx *Tx) handle() uintptr {
+	if tx.breaking.Load() && tx.breaking.CompareAndSwap(true, false) {
+		tx.Break()
+	}
+	return uintptr(unsafe.Pointer(tx.txn))
+}
+
 // Reset a read-only transaction.
 // ingroup c_transactions
 //
@@ -471,7 +583,19 @@ func (tx *Tx) Break() Error {
 //	by current thread.
 //
 // retval MDBX_EINVAL           Transaction handle is NULL.
+//
+// A reset transaction does not hold back Compact, it fails to renew with
+// ErrBadTXN once the environment was compacted and must then be discarded.
 func (tx *Tx) Reset() Error {
+	err := tx.resetRaw()
+	if err == ErrSuccess {
+		tx.leave()
+	}
+	return err
+}
+
+// resetRaw reset the transaction ignoring the compaction gate
+func (tx *Tx) resetRaw() Error {
 	args := struct {
 		txn    uintptr
 		result Error
@@ -513,6 +637,26 @@ func (tx *Tx) Reset() Error {
 //
 // retval MDBX_EINVAL           Transaction handle is NULL.
 func (tx *Tx) Renew() Error {
+	if tx.gated != gateNone {
+		return tx.renewRaw()
+	}
+	tx.gated = tx.env.enter(false)
+	if tx.epoch != tx.env.epoch {
+		// the handle belongs to the environment closed by Compact, where
+		// it cannot be aborted
+		tx.txn = nil
+		tx.leave()
+		return ErrBadTXN
+	}
+	err := tx.renewRaw()
+	if err != ErrSuccess {
+		tx.leave()
+	}
+	return err
+}
+
+// renewRaw renew the transaction ignoring the compaction gate
+func (tx *Tx) renewRaw() Error {
 	args := struct {
 		txn    uintptr
 		result Error
@@ -520,6 +664,7 @@ func (tx *Tx) Renew() Error {
 		txn: uintptr(unsafe.Pointer(tx.txn)),
 	}
 	tx.reset = false
+	tx.breaking.Store(false)
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_renew), ptr, 0)
 	return args.result
@@ -549,12 +694,20 @@ type Canary struct {
 //
 // returns A non-zero error value on failure and 0 on success.
 func (tx *Tx) PutCanary(canary *Canary) Error {
+	err := tx.putCanary(canary)
+	if tx.capture != nil && err == ErrSuccess {
+		tx.captureCanary(canary)
+	}
+	return err
+}
+
+func (tx *Tx) putCanary(canary *Canary) Error {
 	args := struct {
 		txn    uintptr
 		canary uintptr
 		result Error
 	}{
-		txn:    uintptr(unsafe.Pointer(tx.txn)),
+		txn:    tx.handle(),
 		canary: uintptr(unsafe.Pointer(canary)),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
@@ -579,7 +732,7 @@ func (tx *Tx) GetCanary(canary *Canary) Error {
 		canary uintptr
 		result Error
 	}{
-		txn:    uintptr(unsafe.Pointer(tx.txn)),
+		txn:    tx.handle(),
 		canary: uintptr(unsafe.Pointer(canary)),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
@@ -620,7 +773,7 @@ func (tx *Tx) EnvInfo(info *EnvInfo) Error {
 		result int32
 	}{
 		env:  uintptr(unsafe.Pointer(tx.env.env)),
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		info: uintptr(unsafe.Pointer(info)),
 		size: unsafe.Sizeof(C.MDBX_envinfo{}),
 	}
@@ -739,6 +892,10 @@ func (tx *Tx) OpenDBI(name string, flags DBFlags) (DBI, Error) {
 		defer C.free(unsafe.Pointer(n))
 		var dbi DBI
 		err := Error(C.mdbx_dbi_open(tx.txn, n, (C.MDBX_db_flags_t)(flags), (*C.MDBX_dbi)(unsafe.Pointer(&dbi))))
+		if err == ErrSuccess {
+			tx.env.nameDBI(dbi, name)
+			tx.env.attachTableHooks(dbi, name)
+		}
 		return dbi, err
 	}
 }
@@ -781,7 +938,7 @@ func (tx *Tx) DBIStat(dbi DBI, stat *Stats) Error {
 		dbi    uint32
 		result Error
 	}{
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		stat: uintptr(unsafe.Pointer(stat)),
 		size: unsafe.Sizeof(Stats{}),
 		dbi:  uint32(dbi),
@@ -811,7 +968,7 @@ func (tx *Tx) DBIFlags(dbi DBI) (DBFlags, DBIState, Error) {
 		dbi    uint32
 		result Error
 	}{
-		txn:   uintptr(unsafe.Pointer(tx.txn)),
+		txn:   tx.handle(),
 		flags: uintptr(unsafe.Pointer(&flags)),
 		state: uintptr(unsafe.Pointer(&state)),
 		dbi:   uint32(dbi),
@@ -834,13 +991,31 @@ func (tx *Tx) DBIFlags(dbi DBI) (DBFlags, DBIState, Error) {
 //
 // returns A non-zero error value on failure and 0 on success.
 func (tx *Tx) Drop(dbi DBI, del bool) Error {
+	hooks := tx.env.writeHooks(dbi)
+	if hooks == nil {
+		return tx.drop(dbi, del)
+	}
+	if err := tx.hookedDrop(hooks, dbi, del); err != ErrSuccess {
+		return err
+	}
+	if del {
+		// the hooks are unregistered once the deletion commits
+		tx.droppedHooks = append(tx.droppedHooks, dbi)
+	}
+	return ErrSuccess
+}
+
+func (tx *Tx) drop(dbi DBI, del bool) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
 	args := struct {
 		txn    uintptr
 		del    uintptr
 		dbi    uint32
 		result Error
 	}{
-		txn: uintptr(unsafe.Pointer(tx.txn)),
+		txn: tx.handle(),
 		dbi: uint32(dbi),
 	}
 	if del {
@@ -848,6 +1023,14 @@ func (tx *Tx) Drop(dbi DBI, del bool) Error {
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_drop), ptr, 0)
+	if args.result == ErrSuccess {
+		if tx.capture != nil {
+			tx.captureDrop(dbi, del)
+		}
+		if del {
+			tx.env.forgetDBI(dbi)
+		}
+	}
 	return args.result
 }
 
@@ -884,7 +1067,17 @@ func (tx *Tx) Drop(dbi DBI, del bool) Error {
 //
 // retval MDBX_NOTFOUND  The key was not in the database.
 // retval MDBX_EINVAL    An invalid parameter was specified.
+//
+// A pair of a table with TTL whose deadline passed is reported with
+// ErrNotFound.
 func (tx *Tx) Get(dbi DBI, key *Val, data *Val) Error {
+	if st, t := tx.env.ttlTable(dbi); t != nil {
+		return tx.getLive(st, t, dbi, key, data)
+	}
+	return tx.get(dbi, key, data)
+}
+
+func (tx *Tx) get(dbi DBI, key *Val, data *Val) Error {
 	args := struct {
 		txn    uintptr
 		key    uintptr
@@ -892,7 +1085,7 @@ func (tx *Tx) Get(dbi DBI, key *Val, data *Val) Error {
 		dbi    uint32
 		result Error
 	}{
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		key:  uintptr(unsafe.Pointer(key)),
 		data: uintptr(unsafe.Pointer(data)),
 		dbi:  uint32(dbi),
@@ -944,7 +1137,7 @@ func (tx *Tx) GetEqualOrGreat(dbi DBI, key *Val, data *Val) Error {
 		dbi    uint32
 		result Error
 	}{
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		key:  uintptr(unsafe.Pointer(key)),
 		data: uintptr(unsafe.Pointer(data)),
 		dbi:  uint32(dbi),
@@ -1001,7 +1194,7 @@ func (tx *Tx) GetEx(dbi DBI, key *Val, data *Val) (int, Error) {
 		dbi         uint32
 		result      Error
 	}{
-		txn:         uintptr(unsafe.Pointer(tx.txn)),
+		txn:         tx.handle(),
 		key:         uintptr(unsafe.Pointer(key)),
 		data:        uintptr(unsafe.Pointer(data)),
 		valuesCount: uintptr(unsafe.Pointer(&valuesCount)),
@@ -1103,6 +1296,16 @@ func (tx *Tx) GetEx(dbi DBI, key *Val, data *Val) (int, Error) {
 //
 // retval MDBX_EINVAL    An invalid parameter was specified.
 func (tx *Tx) Put(dbi DBI, key *Val, data *Val, flags PutFlags) Error {
+	if hooks := tx.env.writeHooks(dbi); hooks != nil {
+		return tx.hookedPut(hooks, dbi, key, data, flags)
+	}
+	return tx.put(dbi, key, data, flags)
+}
+
+func (tx *Tx) put(dbi DBI, key *Val, data *Val, flags PutFlags) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
 	args := struct {
 		txn    uintptr
 		key    uintptr
@@ -1111,7 +1314,7 @@ func (tx *Tx) Put(dbi DBI, key *Val, data *Val, flags PutFlags) Error {
 		flags  uint32
 		result Error
 	}{
-		txn:   uintptr(unsafe.Pointer(tx.txn)),
+		txn:   tx.handle(),
 		key:   uintptr(unsafe.Pointer(key)),
 		data:  uintptr(unsafe.Pointer(data)),
 		dbi:   uint32(dbi),
@@ -1119,6 +1322,9 @@ func (tx *Tx) Put(dbi DBI, key *Val, data *Val, flags PutFlags) Error {
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_put), ptr, 0)
+	if tx.capture != nil && args.result == ErrSuccess {
+		tx.capturePut(dbi, key, data, flags)
+	}
 	return args.result
 }
 
@@ -1173,6 +1379,20 @@ func (tx *Tx) Put(dbi DBI, key *Val, data *Val, flags PutFlags) Error {
 //
 // returns A non-zero error value on failure and 0 on success.
 func (tx *Tx) Replace(dbi DBI, key *Val, data *Val, oldData *Val, flags PutFlags) Error {
+	if hooks := tx.env.writeHooks(dbi); hooks != nil {
+		return tx.hookedReplace(hooks, dbi, key, data, oldData, flags)
+	}
+	return tx.replace(dbi, key, data, oldData, flags)
+}
+
+func (tx *Tx) replace(dbi DBI, key *Val, data *Val, oldData *Val, flags PutFlags) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
+	var oldIn []byte
+	if tx.capture != nil && oldData != nil {
+		oldIn = oldData.Bytes()
+	}
 	args := struct {
 		txn     uintptr
 		key     uintptr
@@ -1182,7 +1402,7 @@ func (tx *Tx) Replace(dbi DBI, key *Val, data *Val, oldData *Val, flags PutFlags
 		flags   uint32
 		result  Error
 	}{
-		txn:     uintptr(unsafe.Pointer(tx.txn)),
+		txn:     tx.handle(),
 		key:     uintptr(unsafe.Pointer(key)),
 		data:    uintptr(unsafe.Pointer(data)),
 		oldData: uintptr(unsafe.Pointer(oldData)),
@@ -1191,6 +1411,9 @@ func (tx *Tx) Replace(dbi DBI, key *Val, data *Val, oldData *Val, flags PutFlags
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_replace), ptr, 0)
+	if tx.capture != nil && args.result == ErrSuccess {
+		tx.captureReplace(dbi, key, data, oldIn, flags)
+	}
 	return args.result
 }
 
@@ -1224,6 +1447,16 @@ func (tx *Tx) Replace(dbi DBI, key *Val, data *Val, oldData *Val, flags PutFlags
 //
 // retval MDBX_EINVAL   An invalid parameter was specified.
 func (tx *Tx) Delete(dbi DBI, key *Val, data *Val) Error {
+	if hooks := tx.env.writeHooks(dbi); hooks != nil {
+		return tx.hookedDelete(hooks, dbi, key, data)
+	}
+	return tx.delete(dbi, key, data)
+}
+
+func (tx *Tx) delete(dbi DBI, key *Val, data *Val) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(tx.txn)))
+	}
 	args := struct {
 		txn    uintptr
 		key    uintptr
@@ -1231,16 +1464,81 @@ func (tx *Tx) Delete(dbi DBI, key *Val, data *Val) Error {
 		dbi    uint32
 		result Error
 	}{
-		txn:  uintptr(unsafe.Pointer(tx.txn)),
+		txn:  tx.handle(),
 		key:  uintptr(unsafe.Pointer(key)),
 		data: uintptr(unsafe.Pointer(data)),
 		dbi:  uint32(dbi),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_del), ptr, 0)
+	if tx.capture != nil && args.result == ErrSuccess {
+		tx.captureDelete(dbi, key, data)
+	}
 	return args.result
 }
 
+// Cmp Compare two keys according to a particular database.
+// ingroup c_crud
+// see MDBX_cmp_func
+//
+// This returns a comparison as if the two data items were keys in the
+// specified database.
+//
+// param [in] txn   A transaction handle returned by ref mdbx_txn_begin().
+// param [in] dbi   A database handle returned by ref mdbx_dbi_open().
+// param [in] a     The first item to compare.
+// param [in] b     The second item to compare.
+//
+// returns < 0 if a < b, 0 if a == b, > 0 if a > b
+func (tx *Tx) Cmp(dbi DBI, a *Val, b *Val) int {
+	args := struct {
+		txn    uintptr
+		a      uintptr
+		b      uintptr
+		dbi    uint32
+		result int32
+	}{
+		txn: tx.handle(),
+		a:   uintptr(unsafe.Pointer(a)),
+		b:   uintptr(unsafe.Pointer(b)),
+		dbi: uint32(dbi),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cmp), ptr, 0)
+	return int(args.result)
+}
+
+// DCmp Compare two data items according to a particular database.
+// ingroup c_crud
+// see MDBX_cmp_func
+//
+// This returns a comparison as if the two items were data items of the
+// specified database.
+//
+// param [in] txn   A transaction handle returned by ref mdbx_txn_begin().
+// param [in] dbi   A database handle returned by ref mdbx_dbi_open().
+// param [in] a     The first item to compare.
+// param [in] b     The second item to compare.
+//
+// returns < 0 if a < b, 0 if a == b, > 0 if a > b
+func (tx *Tx) DCmp(dbi DBI, a *Val, b *Val) int {
+	args := struct {
+		txn    uintptr
+		a      uintptr
+		b      uintptr
+		dbi    uint32
+		result int32
+	}{
+		txn: tx.handle(),
+		a:   uintptr(unsafe.Pointer(a)),
+		b:   uintptr(unsafe.Pointer(b)),
+		dbi: uint32(dbi),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_dcmp), ptr, 0)
+	return int(args.result)
+}
+
 // Bind cursor to specified transaction and DBI handle.
 // ingroup c_cursors
 //
@@ -1278,12 +1576,15 @@ func (tx *Tx) Bind(cursor *Cursor, dbi DBI) Error {
 		dbi    DBI
 		result Error
 	}{
-		txn:    uintptr(unsafe.Pointer(tx.txn)),
+		txn:    tx.handle(),
 		cursor: uintptr(unsafe.Pointer(cursor)),
 		dbi:    dbi,
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_bind), ptr, 0)
+	if args.result == ErrSuccess {
+		tx.captureBind()
+	}
 	return args.result
 }
 
@@ -1325,19 +1626,27 @@ func (tx *Tx) Bind(cursor *Cursor, dbi DBI) Error {
 //
 // retval MDBX_EINVAL  An invalid parameter was specified.
 func (tx *Tx) OpenCursor(dbi DBI) (*Cursor, Error) {
-	var cursor *C.MDBX_cursor
+	var (
+		cursor *C.MDBX_cursor
+		ctx    *C.cursor_ctx
+	)
 	args := struct {
 		txn    uintptr
 		cursor uintptr
+		ctx    uintptr
 		dbi    DBI
 		result Error
 	}{
-		txn:    uintptr(unsafe.Pointer(tx.txn)),
+		txn:    tx.handle(),
 		cursor: uintptr(unsafe.Pointer(&cursor)),
+		ctx:    uintptr(unsafe.Pointer(&ctx)),
 		dbi:    dbi,
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
-	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_open), ptr, 0)
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_open_tracked), ptr, 0)
+	if args.result == ErrSuccess {
+		tx.trackCursor(ctx)
+	}
 	return (*Cursor)(unsafe.Pointer(cursor)), args.result
 }
 
@@ -1357,8 +1666,19 @@ func (tx *Tx) OpenCursor(dbi DBI) (*Cursor, Error) {
 //
 //	or ref mdbx_cursor_create().
 func (cur *Cursor) Close() Error {
-	ptr := uintptr(unsafe.Pointer(cur))
-	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_close), ptr, 0)
+	return cur.close()
+}
+
+func (cur *Cursor) close() Error {
+	args := struct {
+		cursor uintptr
+		ctx    uintptr
+	}{
+		cursor: uintptr(unsafe.Pointer(cur)),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_close_ex), ptr, 0)
+	releaseUserData(args.ctx)
 	return ErrSuccess
 }
 
@@ -1396,11 +1716,14 @@ func (cur *Cursor) Renew(tx *Tx) Error {
 		cursor uintptr
 		result Error
 	}{
-		txn:    uintptr(unsafe.Pointer(tx.txn)),
+		txn:    tx.handle(),
 		cursor: uintptr(unsafe.Pointer(cur)),
 	}
 	ptr := uintptr(unsafe.Pointer(&args))
 	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_renew), ptr, 0)
+	if args.result == ErrSuccess {
+		tx.captureBind()
+	}
 	return args.result
 }
 
@@ -1595,6 +1918,9 @@ func (cur *Cursor) Get(key *Val, data *Val, op CursorOp) Error {
 //
 // retval MDBX_EINVAL        An invalid parameter was specified.
 func (cur *Cursor) Put(key *Val, data *Val, flags PutFlags) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(cur.Tx())))
+	}
 	args := struct {
 		cursor uintptr
 		key    uintptr
@@ -1651,6 +1977,9 @@ func (cur *Cursor) Put(key *Val, data *Val, flags PutFlags) Error {
 //
 // retval MDBX_EINVAL        An invalid parameter was specified.
 func (cur *Cursor) Delete(flags PutFlags) Error {
+	if debugReserve {
+		flushReserved(uintptr(unsafe.Pointer(cur.Tx())))
+	}
 	args := struct {
 		cursor uintptr
 		flags  PutFlags
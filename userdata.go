@@ -0,0 +1,139 @@
+package gmdbx
+
+//#include "mdbxgo.h"
+import "C"
+import (
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/sunvim/gmdbx/unsafecgo"
+)
+
+// Go values are attached to MDBX objects as their userctx through a
+// cgo.Handle, so the pointer stored in C never refers to Go memory. The
+// handle is released when the object is closed, or replaced by another value.
+
+func newUserData(v any) cgo.Handle {
+	if v == nil {
+		return 0
+	}
+	return cgo.NewHandle(v)
+}
+
+func releaseUserData(ctx uintptr) {
+	if ctx != 0 {
+		cgo.Handle(ctx).Delete()
+	}
+}
+
+func userDataValue(ctx uintptr) any {
+	if ctx == 0 {
+		return nil
+	}
+	return cgo.Handle(ctx).Value()
+}
+
+// SetUserData attach v to the environment, it can be recovered by
+// mdbx_env_get_userctx() in C callbacks as a cgo.Handle and is released by
+// Close. A nil v detaches the current value.
+func (env *Env) SetUserData(v any) Error {
+	h := newUserData(v)
+	args := struct {
+		handle uintptr
+		ctx    uintptr
+		result Error
+	}{
+		handle: uintptr(unsafe.Pointer(env.env)),
+		ctx:    uintptr(h),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_env_set_userctx), ptr, 0)
+	if args.result != ErrSuccess {
+		releaseUserData(uintptr(h))
+		return args.result
+	}
+	releaseUserData(uintptr(env.userData))
+	env.userData = h
+	return ErrSuccess
+}
+
+// UserData return the value attached by SetUserData
+func (env *Env) UserData() any {
+	return userDataValue(uintptr(env.userData))
+}
+
+// SetUserData attach v to the transaction, it can be recovered by
+// mdbx_txn_get_userctx() in C callbacks as a cgo.Handle and is released when
+// the transaction is committed or aborted. A nil v detaches the current value.
+func (tx *Tx) SetUserData(v any) Error {
+	h := newUserData(v)
+	args := struct {
+		handle uintptr
+		ctx    uintptr
+		result Error
+	}{
+		handle: uintptr(unsafe.Pointer(tx.txn)),
+		ctx:    uintptr(h),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_txn_set_userctx), ptr, 0)
+	if args.result != ErrSuccess {
+		releaseUserData(uintptr(h))
+		return args.result
+	}
+	releaseUserData(uintptr(tx.userData))
+	tx.userData = h
+	return ErrSuccess
+}
+
+// UserData return the value attached by SetUserData
+func (tx *Tx) UserData() any {
+	return userDataValue(uintptr(tx.userData))
+}
+
+func (tx *Tx) releaseUserData() {
+	releaseUserData(uintptr(tx.userData))
+	tx.userData = 0
+}
+
+// SetUserData attach v to the cursor, it is released by Close. The userctx of
+// a cursor is the cursor_ctx used to track it, which holds the cgo.Handle.
+// A nil v detaches the current value.
+func (cur *Cursor) SetUserData(v any) Error {
+	old := cur.userctx()
+	h := newUserData(v)
+	args := struct {
+		handle uintptr
+		ctx    uintptr
+		result Error
+	}{
+		handle: uintptr(unsafe.Pointer(cur)),
+		ctx:    uintptr(h),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_set_userctx), ptr, 0)
+	if args.result != ErrSuccess {
+		releaseUserData(uintptr(h))
+		return args.result
+	}
+	releaseUserData(old)
+	return ErrSuccess
+}
+
+// UserData return the value attached by SetUserData
+func (cur *Cursor) UserData() any {
+	return userDataValue(cur.userctx())
+}
+
+func (cur *Cursor) userctx() uintptr {
+	args := struct {
+		handle uintptr
+		ctx    uintptr
+		result Error
+	}{
+		handle: uintptr(unsafe.Pointer(cur)),
+	}
+	ptr := uintptr(unsafe.Pointer(&args))
+	unsafecgo.NonBlocking((*byte)(C.do_mdbx_cursor_get_userctx), ptr, 0)
+	return args.ctx
+}
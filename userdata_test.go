@@ -0,0 +1,55 @@
+package gmdbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type requestMeta struct {
+	ID string
+}
+
+func TestUserData(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	meta := &requestMeta{ID: "req-1"}
+	assert.Equal(t, ErrSuccess, db.env.SetUserData(meta))
+	assert.Same(t, meta, db.env.UserData())
+
+	err = db.Update(func(tx *Tx) error {
+		assert.Nil(t, tx.UserData())
+		assert.Equal(t, ErrSuccess, tx.SetUserData("txn"))
+		assert.Equal(t, "txn", tx.UserData())
+		assert.Equal(t, ErrSuccess, tx.SetUserData(42))
+		assert.Equal(t, 42, tx.UserData())
+
+		dbi, e := tx.OpenDBI("userdata", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		cur, e := tx.OpenCursor(dbi)
+		if e != ErrSuccess {
+			return e
+		}
+		defer cur.Close()
+
+		assert.Nil(t, cur.UserData())
+		assert.Equal(t, ErrSuccess, cur.SetUserData(meta))
+		assert.Same(t, meta, cur.UserData())
+		assert.Equal(t, ErrSuccess, cur.SetUserData(nil))
+		assert.Nil(t, cur.UserData())
+		assert.Equal(t, ErrSuccess, cur.SetUserData("cursor"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	cur := NewCursor()
+	assert.Equal(t, ErrSuccess, cur.SetUserData(meta))
+	assert.Same(t, meta, cur.UserData())
+	cur.Close()
+}
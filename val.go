@@ -12,6 +12,9 @@ import (
 
 type Val syscall.Iovec
 
+// ToVal point to the memory of v, in native byte order. Such keys only sort
+// correctly with DBIntegerKey, package keys has order-preserving encodings
+// for the default comparator.
 func ToVal[T int | uint | int8 | uint8 | int16 | uint16 | int32 | uint32 | int64 | uint64 | float32 | float64](v T) Val {
 	return Val{
 		Base: (*byte)(unsafe.Pointer(&v)),
@@ -131,6 +134,17 @@ func Bytes(b *[]byte) Val {
 	}
 }
 
+// bytesVal like Bytes, but an empty or nil slice gives an empty Val
+func bytesVal(b []byte) Val {
+	if len(b) == 0 {
+		return Val{}
+	}
+	return Val{
+		Base: unsafe.SliceData(b),
+		Len:  uint64(len(b)),
+	}
+}
+
 func String(s *string) Val {
 	return Val{
 		Base: unsafe.StringData(*s),
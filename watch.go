@@ -0,0 +1,363 @@
+package gmdbx
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// ChangeOp kind of a change reported by Watch
+type ChangeOp int
+
+const (
+	// ChangePut the key was inserted or updated
+	ChangePut ChangeOp = iota
+	// ChangeDelete the key, or some of its values, was deleted
+	ChangeDelete
+	// ChangeDrop all pairs of the table were deleted, Key is nil
+	ChangeDrop
+)
+
+// Change a key written by a committed transaction
+type Change struct {
+	Op  ChangeOp
+	Key []byte
+}
+
+// ChangeEvent keys of a table changed by a committed transaction, each key
+// appears once with the last operation done on it.
+type ChangeEvent struct {
+	TxnID   uint64
+	DBI     DBI
+	Changes []Change
+	// Missed number of events dropped for this watcher since the previous
+	// delivered one because its buffer was full.
+	Missed uint64
+}
+
+// OverflowPolicy what Watch does when the buffer of a watcher is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drop the new event, counted in the Missed field of
+	// the next delivered one.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drop the oldest buffered event to make room.
+	OverflowDropOldest
+	// OverflowBlock wait for the watcher to receive, the committing goroutine
+	// and the following commits with watched changes wait too.
+	OverflowBlock
+)
+
+// WatchOptions selection of keys and buffering of a watcher
+type WatchOptions struct {
+	// Prefix only keys starting with Prefix are reported.
+	Prefix []byte
+	// Start and End only keys in [Start, End) are reported, compared
+	// bytewise, a nil bound is open.
+	Start, End []byte
+	// Buffer capacity of the channel, default 64.
+	Buffer int
+	// Overflow policy when the channel is full.
+	Overflow OverflowPolicy
+}
+
+type watchSub struct {
+	opts   WatchOptions
+	ch     chan ChangeEvent
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	missed uint64
+}
+
+func (s *watchSub) match(key []byte) bool {
+	if key == nil {
+		return true
+	}
+	if !bytes.HasPrefix(key, s.opts.Prefix) {
+		return false
+	}
+	if s.opts.Start != nil && bytes.Compare(key, s.opts.Start) < 0 {
+		return false
+	}
+	if s.opts.End != nil && bytes.Compare(key, s.opts.End) >= 0 {
+		return false
+	}
+	return true
+}
+
+// send deliver ev according to the overflow policy
+func (s *watchSub) send(ev ChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	ev.Missed = s.missed
+	switch s.opts.Overflow {
+	case OverflowBlock:
+		select {
+		case s.ch <- ev:
+			s.missed = 0
+		case <-s.done:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- ev:
+				s.missed = 0
+				return
+			default:
+			}
+			select {
+			case old := <-s.ch:
+				ev.Missed += 1 + old.Missed
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- ev:
+			s.missed = 0
+		default:
+			s.missed++
+		}
+	}
+}
+
+// close stop delivering and close the channel
+func (s *watchSub) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// watchHub watchers of a table, registered as its write hook while it has
+// watchers.
+type watchHub struct {
+	db   *DB
+	dbi  DBI
+	mu   sync.Mutex
+	subs map[*watchSub]struct{}
+}
+
+func (h *watchHub) snapshot() []*watchSub {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := make([]*watchSub, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+func (h *watchHub) matches(key []byte) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if s.match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *watchHub) check(tx *Tx, c *change) Error {
+	return ErrSuccess
+}
+
+func (h *watchHub) apply(tx *Tx, c *change) Error {
+	if !h.matches(c.key) {
+		return ErrSuccess
+	}
+	op := ChangePut
+	if !c.hasNew {
+		op = ChangeDelete
+	}
+	tx.watched = append(tx.watched, watchedChange{hub: h, Change: Change{Op: op, Key: append([]byte{}, c.key...)}})
+	return ErrSuccess
+}
+
+func (h *watchHub) drop(tx *Tx, dbi DBI) Error {
+	tx.watched = append(tx.watched, watchedChange{hub: h, Change: Change{Op: ChangeDrop}})
+	return ErrSuccess
+}
+
+// removed close the watchers of a deleted table
+func (h *watchHub) removed(dbi DBI) {
+	h.db.watchMu.Lock()
+	if h.db.watchHubs[dbi] == h {
+		delete(h.db.watchHubs, dbi)
+	}
+	h.db.watchMu.Unlock()
+	for _, s := range h.snapshot() {
+		s.close()
+	}
+}
+
+type watchedChange struct {
+	hub *watchHub
+	Change
+}
+
+// Watch report the changes made to dbi by transactions of this process after
+// they commit, until ctx is done, the table is deleted or its handle closed,
+// or the database is closed, then the channel is closed. Only writes through Tx.Put, Tx.Replace, Tx.Delete and Tx.Drop
+// are seen.
+func (d *DB) Watch(ctx context.Context, dbi DBI, opts WatchOptions) <-chan ChangeEvent {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	s := &watchSub{
+		opts: opts,
+		ch:   make(chan ChangeEvent, opts.Buffer),
+		done: make(chan struct{}),
+	}
+
+	d.watchMu.Lock()
+	h := d.watchHubs[dbi]
+	if h == nil {
+		h = &watchHub{db: d, dbi: dbi, subs: make(map[*watchSub]struct{})}
+		d.watchHubs[dbi] = h
+		d.env.addHook(dbi, h)
+	}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	d.watchMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		d.unwatch(h, s)
+		s.close()
+	}()
+	return s.ch
+}
+
+func (d *DB) unwatch(h *watchHub, s *watchSub) {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	h.mu.Lock()
+	delete(h.subs, s)
+	empty := len(h.subs) == 0
+	h.mu.Unlock()
+	if empty && d.watchHubs[h.dbi] == h {
+		delete(d.watchHubs, h.dbi)
+		d.env.removeHook(h.dbi, h)
+	}
+}
+
+// closeWatchers close the channels of all watchers
+func (d *DB) closeWatchers() {
+	d.watchMu.Lock()
+	var subs []*watchSub
+	for _, h := range d.watchHubs {
+		subs = append(subs, h.snapshot()...)
+	}
+	d.watchMu.Unlock()
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+// publish deliver the watched changes of a committed transaction
+func publish(txnID uint64, watched []watchedChange) {
+	for len(watched) > 0 {
+		h := watched[0].hub
+		var changes []Change
+		seen := map[string]int{}
+		rest := watched[:0]
+		for _, w := range watched {
+			if w.hub != h {
+				rest = append(rest, w)
+				continue
+			}
+			if w.Op == ChangeDrop {
+				changes = append(changes, w.Change)
+				continue
+			}
+			if i, ok := seen[string(w.Key)]; ok {
+				changes[i].Op = w.Op
+				continue
+			}
+			seen[string(w.Key)] = len(changes)
+			changes = append(changes, w.Change)
+		}
+		watched = rest
+
+		for _, s := range h.snapshot() {
+			var selected []Change
+			for _, c := range changes {
+				if s.match(c.Key) {
+					selected = append(selected, c)
+				}
+			}
+			if len(selected) > 0 {
+				s.send(ChangeEvent{TxnID: txnID, DBI: h.dbi, Changes: selected})
+			}
+		}
+	}
+}
+
+// OnCommit run fn after the transaction commits successfully, with the ID of
+// the committed transaction. Callbacks run in registration order on the
+// goroutine calling Commit and are dropped if the transaction aborts.
+func (tx *Tx) OnCommit(fn func(txnID uint64)) {
+	tx.onCommit = append(tx.onCommit, fn)
+}
+
+// beforeCommit capture the transaction ID for the commit callbacks and keep
+// the watched changes of concurrent commits in commit order.
+func (tx *Tx) beforeCommit() (uint64, bool) {
+	if len(tx.onCommit) == 0 && len(tx.watched) == 0 && tx.capture == nil {
+		return 0, false
+	}
+	if len(tx.watched) > 0 {
+		// the lock is taken while the transaction still holds the writer
+		// lock, so the next writer publishes after this one
+		tx.env.publishMu.Lock()
+		return tx.ID(), true
+	}
+	return tx.ID(), false
+}
+
+func (tx *Tx) afterCommit(id uint64, publishing bool, result Error) {
+	if tx.capture != nil {
+		tx.captureCommit(id, result)
+	}
+	if publishing {
+		if result == ErrSuccess {
+			publish(id, tx.watched)
+		}
+		tx.env.publishMu.Unlock()
+	}
+	if result == ErrSuccess {
+		for _, fn := range tx.onCommit {
+			fn(id)
+		}
+		for _, dbi := range tx.droppedHooks {
+			tx.env.dropHooks(dbi)
+		}
+	}
+	if result != ErrThreadMismatch {
+		tx.clearOnCommit()
+	}
+}
+
+func (tx *Tx) clearOnCommit() {
+	clear(tx.onCommit)
+	tx.onCommit = tx.onCommit[:0]
+	clear(tx.watched)
+	tx.watched = tx.watched[:0]
+	tx.droppedHooks = tx.droppedHooks[:0]
+}
@@ -0,0 +1,150 @@
+package gmdbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func watchWrite(t *testing.T, db *DB, fn func(tx *Tx) error) uint64 {
+	var id uint64
+	err := db.update(func(tx *Tx) error {
+		tx.OnCommit(func(txnID uint64) { id = txnID })
+		return fn(tx)
+	})
+	assert.NoError(t, err)
+	return id
+}
+
+func receive(t *testing.T, ch <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return ChangeEvent{}
+}
+
+func TestWatch(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+	dbi := openLoaderDBI(t, db, "watch", DBCreate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	users := db.Watch(ctx, dbi, WatchOptions{Prefix: []byte("user/")})
+	ranged := db.Watch(ctx, dbi, WatchOptions{Start: []byte("a"), End: []byte("b")})
+
+	id := watchWrite(t, db, func(tx *Tx) error {
+		for _, k := range []string{"user/1", "user/2", "other", "user/1"} {
+			if e := indexPut(tx, dbi, k, "v"); e != ErrSuccess {
+				return e
+			}
+		}
+		k := bytesVal([]byte("user/1"))
+		if e := tx.Delete(dbi, &k, nil); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NotZero(t, id)
+
+	ev := receive(t, users)
+	assert.Equal(t, ChangeEvent{TxnID: id, DBI: dbi, Changes: []Change{
+		{Op: ChangeDelete, Key: []byte("user/1")},
+		{Op: ChangePut, Key: []byte("user/2")},
+	}}, ev)
+
+	// aborted writes are not reported
+	failed := errors.New("failed")
+	err = db.update(func(tx *Tx) error {
+		tx.OnCommit(func(uint64) { t.Fatal("aborted transaction committed") })
+		indexPut(tx, dbi, "user/3", "v")
+		return failed
+	})
+	assert.Equal(t, failed, err)
+
+	id = watchWrite(t, db, func(tx *Tx) error {
+		indexPut(tx, dbi, "abc", "v")
+		indexPut(tx, dbi, "user/4", "v")
+		return nil
+	})
+	ev = receive(t, ranged)
+	assert.Equal(t, id, ev.TxnID)
+	assert.Equal(t, []Change{{Op: ChangePut, Key: []byte("abc")}}, ev.Changes)
+	ev = receive(t, users)
+	assert.Equal(t, id, ev.TxnID)
+	assert.Equal(t, []Change{{Op: ChangePut, Key: []byte("user/4")}}, ev.Changes)
+
+	watchWrite(t, db, func(tx *Tx) error {
+		if e := tx.Drop(dbi, false); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.Equal(t, []Change{{Op: ChangeDrop}}, receive(t, users).Changes)
+	assert.Equal(t, []Change{{Op: ChangeDrop}}, receive(t, ranged).Changes)
+
+	cancel()
+	for range users {
+	}
+	for range ranged {
+	}
+	assert.Eventually(t, func() bool { return db.env.writeHooks(dbi) == nil }, time.Second, time.Millisecond)
+}
+
+func TestWatchOverflow(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	dbi := openLoaderDBI(t, db, "watch", DBCreate)
+
+	ctx := context.Background()
+	newest := db.Watch(ctx, dbi, WatchOptions{Buffer: 1})
+	oldest := db.Watch(ctx, dbi, WatchOptions{Buffer: 1, Overflow: OverflowDropOldest})
+	blocking := db.Watch(ctx, dbi, WatchOptions{Buffer: 1, Overflow: OverflowBlock})
+
+	put := func(key string) uint64 {
+		return watchWrite(t, db, func(tx *Tx) error {
+			if e := indexPut(tx, dbi, key, "v"); e != ErrSuccess {
+				return e
+			}
+			return nil
+		})
+	}
+	first := put("1")
+	done := make(chan uint64)
+	go func() {
+		// blocks until the blocking watcher receives the first event
+		done <- put("2")
+	}()
+	assert.Equal(t, first, receive(t, blocking).TxnID)
+	second := <-done
+	assert.Equal(t, second, receive(t, blocking).TxnID)
+
+	ev := receive(t, newest)
+	assert.Equal(t, first, ev.TxnID)
+	third := put("3")
+	ev = receive(t, newest)
+	assert.Equal(t, third, ev.TxnID)
+	assert.Equal(t, uint64(1), ev.Missed)
+
+	ev = receive(t, oldest)
+	assert.Equal(t, third, ev.TxnID)
+	assert.Equal(t, uint64(2), ev.Missed)
+
+	// closing the database closes the channels, even of a blocked watcher
+	assert.NoError(t, db.Close())
+	for range newest {
+	}
+	for range blocking {
+	}
+}
@@ -0,0 +1,279 @@
+package gmdbx
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWriterClosed = errors.New("writer closed")
+	ErrQueueFull    = errors.New("writer queue full")
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// WriterOptions configuration of a Writer
+type WriterOptions struct {
+	// QueueSize maximum number of pending writes, Submit blocks when the
+	// queue is full, default 1024.
+	QueueSize int
+	// NoSync commit with TxNoSync and flush to disk periodically instead, a
+	// resolved future is then not durable until the next sync.
+	NoSync bool
+	// SyncInterval how often the environment is synced in NoSync mode,
+	// default 100ms.
+	SyncInterval time.Duration
+}
+
+// Future result of a write submitted to a Writer
+type Future struct {
+	done  chan struct{}
+	err   error
+	txnID uint64
+}
+
+func (f *Future) resolve(txnID uint64, err error) {
+	f.txnID = txnID
+	f.err = err
+	close(f.done)
+}
+
+// Done closed once the write is committed or failed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait block until the write is committed or failed
+func (f *Future) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// TxnID return the ID of the transaction which committed the write, valid
+// after Done is closed.
+func (f *Future) TxnID() uint64 {
+	<-f.done
+	return f.txnID
+}
+
+type writeReq struct {
+	fn     func(*Tx) error
+	future *Future
+}
+
+// Writer runs write closures one by one on a goroutine locked to its OS
+// thread, as write transactions are bound to the thread which began them.
+// Each closure runs in its own write transaction, committed if it returns
+// nil and aborted otherwise.
+type Writer struct {
+	db   *DB
+	opts WriterOptions
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues [PriorityHigh + 1][]writeReq
+	queued int
+	closed bool
+
+	stopSync   chan struct{}
+	syncExited chan struct{}
+	exited     chan struct{}
+}
+
+// NewWriter start a dedicated writer, it is drained and stopped by DB.Close
+func (d *DB) NewWriter(opts WriterOptions) *Writer {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = 100 * time.Millisecond
+	}
+	w := &Writer{
+		db:         d,
+		opts:       opts,
+		stopSync:   make(chan struct{}),
+		syncExited: make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	d.writersMu.Lock()
+	d.writers[w] = struct{}{}
+	d.writersMu.Unlock()
+
+	go w.loop()
+	if opts.NoSync {
+		go w.syncLoop()
+	}
+	return w
+}
+
+// Submit queue fn with normal priority, it blocks while the queue is full
+func (w *Writer) Submit(fn func(*Tx) error) *Future {
+	return w.SubmitPriority(PriorityNormal, fn)
+}
+
+// SubmitPriority queue fn, pending writes of higher priority run first
+func (w *Writer) SubmitPriority(p Priority, fn func(*Tx) error) *Future {
+	f := &Future{done: make(chan struct{})}
+
+	w.mu.Lock()
+	for w.queued >= w.opts.QueueSize && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		f.resolve(0, ErrWriterClosed)
+		return f
+	}
+	w.push(p, writeReq{fn: fn, future: f})
+	w.mu.Unlock()
+	return f
+}
+
+// TrySubmit queue fn without blocking, ErrQueueFull is returned if there is
+// no room left.
+func (w *Writer) TrySubmit(p Priority, fn func(*Tx) error) (*Future, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, ErrWriterClosed
+	}
+	if w.queued >= w.opts.QueueSize {
+		return nil, ErrQueueFull
+	}
+	f := &Future{done: make(chan struct{})}
+	w.push(p, writeReq{fn: fn, future: f})
+	return f, nil
+}
+
+// Len return the number of pending writes
+func (w *Writer) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.queued
+}
+
+func (w *Writer) push(p Priority, req writeReq) {
+	if p < PriorityLow {
+		p = PriorityLow
+	} else if p > PriorityHigh {
+		p = PriorityHigh
+	}
+	w.queues[p] = append(w.queues[p], req)
+	w.queued++
+	w.cond.Broadcast()
+}
+
+// next pop the pending write of highest priority, false is returned once the
+// writer is closed and drained.
+func (w *Writer) next() (writeReq, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.queued == 0 && !w.closed {
+		w.cond.Wait()
+	}
+	if w.queued == 0 {
+		return writeReq{}, false
+	}
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		q := w.queues[p]
+		if len(q) == 0 {
+			continue
+		}
+		req := q[0]
+		q[0] = writeReq{}
+		w.queues[p] = q[1:]
+		w.queued--
+		w.cond.Broadcast()
+		return req, true
+	}
+	return writeReq{}, false
+}
+
+func (w *Writer) loop() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(w.exited)
+
+	flags := TxReadWrite
+	if w.opts.NoSync {
+		flags |= TxNoSync
+	}
+	for {
+		req, ok := w.next()
+		if !ok {
+			return
+		}
+		req.future.resolve(w.run(flags, req.fn))
+	}
+}
+
+func (w *Writer) run(flags TxFlags, fn func(*Tx) error) (uint64, error) {
+	txn := NewTransaction(w.db.env)
+	if err := w.db.env.Begin(txn, flags); err != ErrSuccess {
+		return 0, err
+	}
+	if err := safelyCall(fn, txn); err != nil {
+		txn.Abort()
+		return 0, err
+	}
+	id := txn.ID()
+	if err := txn.Commit(); err != ErrSuccess {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (w *Writer) syncLoop() {
+	defer close(w.syncExited)
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.db.env.Sync(true, false)
+		case <-w.stopSync:
+			return
+		}
+	}
+}
+
+// Close stop accepting writes, wait for the pending ones to finish and sync
+// the environment in NoSync mode.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		<-w.exited
+		if w.opts.NoSync {
+			<-w.syncExited
+		}
+		return nil
+	}
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	<-w.exited
+	w.db.writersMu.Lock()
+	delete(w.db.writers, w)
+	w.db.writersMu.Unlock()
+
+	if w.opts.NoSync {
+		close(w.stopSync)
+		<-w.syncExited
+		if err := w.db.env.Sync(true, false); err != ErrSuccess && err != ErrResultTrue {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package gmdbx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	db, err := newTestDb()
+	if err != nil {
+		t.Fatal("open db failed: ", err)
+	}
+	defer db.Close()
+
+	w := db.NewWriter(WriterOptions{QueueSize: 8, NoSync: true})
+
+	var dbi DBI
+	err = w.Submit(func(tx *Tx) error {
+		var e Error
+		dbi, e = tx.OpenDBI("writer", DBCreate)
+		if e != ErrSuccess {
+			return e
+		}
+		return nil
+	}).Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 100
+	futures := make([]*Future, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			futures[i] = w.SubmitPriority(Priority(i%3), func(tx *Tx) error {
+				k := ToVal(uint64(i))
+				if e := tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+					return e
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, f := range futures {
+		assert.NoError(t, f.Wait())
+		assert.NotZero(t, f.TxnID())
+	}
+
+	failed := errors.New("failed")
+	assert.Equal(t, failed, w.Submit(func(tx *Tx) error { return failed }).Wait())
+
+	// pending writes are drained by Close
+	last := w.Submit(func(tx *Tx) error {
+		k := ToVal(uint64(n))
+		if e := tx.Put(dbi, &k, &k, PutUpsert); e != ErrSuccess {
+			return e
+		}
+		return nil
+	})
+	assert.NoError(t, w.Close())
+	select {
+	case <-w.syncExited:
+	default:
+		t.Fatal("sync loop still running after Close")
+	}
+	assert.NoError(t, last.Wait())
+	assert.Equal(t, ErrWriterClosed, w.Submit(func(tx *Tx) error { return nil }).Wait())
+
+	err = db.View(func(tx *Tx) error {
+		var st Stats
+		if e := tx.DBIStat(dbi, &st); e != ErrSuccess {
+			return e
+		}
+		assert.Equal(t, uint64(n+1), st.Entries)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}